@@ -1,8 +1,14 @@
 package main
 
 import (
+	"crypto/sha1"
+	"fmt"
+	"math"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	jp "github.com/buger/jsonparser"
 	"github.com/prometheus/client_golang/prometheus"
@@ -11,6 +17,8 @@ import (
 const (
 	namespace = "ravendb"
 	subsystem = ""
+
+	clusterNodeClearance = "ClusterNode"
 )
 
 type metricInfo struct {
@@ -19,6 +27,18 @@ type metricInfo struct {
 }
 
 type exporter struct {
+	provider *statsProvider
+	mutex    sync.Mutex
+
+	scrapeDuration         prometheus.Gauge
+	snapshotAge            prometheus.Gauge
+	lastCollectionSuccess  prometheus.Gauge
+	scrapeHTTPRequests     *prometheus.GaugeVec
+	databasesDiscovered    prometheus.Gauge
+	databasesSkipped       prometheus.Gauge
+	scrapeEndpointSuccess  *prometheus.GaugeVec
+	scrapeEndpointDuration *prometheus.GaugeVec
+
 	up                         prometheus.Gauge
 	workingSet                 prometheus.Gauge
 	cpuTime                    prometheus.Counter
@@ -30,22 +50,136 @@ type exporter struct {
 	mapReduceIndexMappedTotal  prometheus.Counter
 	mapReduceIndexReducedTotal prometheus.Counter
 
+	licenseInfo                 *prometheus.GaugeVec
+	licenseExpiration           prometheus.Gauge
+	licenseExpired              prometheus.Gauge
+	licenseMaxCores             prometheus.Gauge
+	licenseMaxMemory            prometheus.Gauge
+	licenseMaxClusterSize       prometheus.Gauge
+	licenseUtilizedCores        *prometheus.GaugeVec
+	licenseClusterUtilizedCores prometheus.Gauge
+
+	cpuProcessTime    *prometheus.CounterVec
+	cpuUsage          *prometheus.GaugeVec
+	cpuProcessors     *prometheus.GaugeVec
+	threadPoolThreads *prometheus.GaugeVec
+
+	memoryBytes                *prometheus.GaugeVec
+	memoryLow                  prometheus.Gauge
+	memoryThreadUnmanagedBytes *prometheus.GaugeVec
+
+	clusterTerm          prometheus.Gauge
+	clusterTermChanges   prometheus.Counter
+	clusterLastLogIndex  prometheus.Gauge
+	clusterCommitIndex   prometheus.Gauge
+	clusterAppliedIndex  prometheus.Gauge
+	clusterCommitLag     prometheus.Gauge
+	clusterApplyLag      prometheus.Gauge
+	clusterState         *prometheus.GaugeVec
+	clusterNodeState     *prometheus.GaugeVec
+	clusterNodeConnected *prometheus.GaugeVec
+
+	// lastTerm is the Raft term seen in the previous scrape, 0 before the first one. The
+	// clusterTermChanges counter derived from it is nil for probes, see newProbeExporter
+	lastTerm float64
+
 	databaseDocuments    *prometheus.GaugeVec
 	databaseIndexes      *prometheus.GaugeVec
 	databaseStaleIndexes *prometheus.GaugeVec
 	databaseSize         *prometheus.GaugeVec
 	databaseTasks        *prometheus.GaugeVec
 
+	collectionDocuments      *prometheus.GaugeVec
+	collectionSize           *prometheus.GaugeVec
+	collectionDocumentsSize  *prometheus.GaugeVec
+	collectionTombstonesSize *prometheus.GaugeVec
+	collectionRevisionsSize  *prometheus.GaugeVec
+
+	indexState            *prometheus.GaugeVec
+	indexStale            *prometheus.GaugeVec
+	indexPriority         *prometheus.GaugeVec
+	indexErrors           *prometheus.GaugeVec
+	indexEntries          *prometheus.GaugeVec
+	indexLastIndexingAge  *prometheus.GaugeVec
+	indexMappedPerSecond  *prometheus.GaugeVec
+	indexReducedPerSecond *prometheus.GaugeVec
+
+	storageAllocated      *prometheus.GaugeVec
+	storageUsed           *prometheus.GaugeVec
+	storageFree           *prometheus.GaugeVec
+	storageJournals       *prometheus.GaugeVec
+	storageScratchBuffers *prometheus.GaugeVec
+
+	backupLastFull        *prometheus.GaugeVec
+	backupLastIncremental *prometheus.GaugeVec
+	backupNext            *prometheus.GaugeVec
+	backupLastDuration    *prometheus.GaugeVec
+	backupLastFailed      *prometheus.GaugeVec
+	backupDestination     *prometheus.GaugeVec
+
+	replicationLastAcceptedEtag        *prometheus.GaugeVec
+	replicationLastSentEtag            *prometheus.GaugeVec
+	replicationEtagLag                 *prometheus.GaugeVec
+	replicationLastHeartbeatAge        *prometheus.GaugeVec
+	replicationFailing                 *prometheus.GaugeVec
+	replicationIncomingLastActivityAge *prometheus.GaugeVec
+
+	etlLastProcessedEtag    *prometheus.GaugeVec
+	etlDocumentsToProcess   *prometheus.GaugeVec
+	etlTombstonesToProcess  *prometheus.GaugeVec
+	etlFallback             *prometheus.GaugeVec
+	etlLastLoadSuccessful   *prometheus.GaugeVec
+	etlItemsExtracted       *prometheus.GaugeVec
+	etlLoadedTotal          *prometheus.CounterVec
+	etlLoadErrorsTotal      *prometheus.CounterVec
+	etlTransformErrorsTotal *prometheus.CounterVec
+
+	subscriptionConnectedWorkers      *prometheus.GaugeVec
+	subscriptionLastAcknowledgedEtag  *prometheus.GaugeVec
+	subscriptionEtagLag               *prometheus.GaugeVec
+	subscriptionLastClientActivityAge *prometheus.GaugeVec
+	subscriptionLastBatchDocuments    *prometheus.GaugeVec
+	subscriptionLastBatchSize         *prometheus.GaugeVec
+	subscriptionLastBatchDuration     *prometheus.GaugeVec
+
+	databaseNodeState         *prometheus.GaugeVec
+	databaseNodeHealthy       *prometheus.GaugeVec
+	databaseReplicationFactor *prometheus.GaugeVec
+	databaseHealthyMembers    *prometheus.GaugeVec
+	databaseDisabled          *prometheus.GaugeVec
+	databaseEncrypted         *prometheus.GaugeVec
+	databaseSharded           *prometheus.GaugeVec
+
+	certificateExpiry *prometheus.GaugeVec
+
 	databaseRequestTotal               *prometheus.CounterVec
 	databaseDocumentPutTotal           *prometheus.CounterVec
 	databaseDocumentPutBytes           *prometheus.CounterVec
 	databaseMapIndexIndexedTotal       *prometheus.CounterVec
 	databaseMapReduceIndexMappedTotal  *prometheus.CounterVec
 	databaseMapReduceIndexReducedTotal *prometheus.CounterVec
+
+	meterTotal            *prometheus.CounterVec
+	meterRate             *prometheus.GaugeVec
+	timerDuration         *prometheus.Desc
+	databaseMeterTotal    *prometheus.CounterVec
+	databaseMeterRate     *prometheus.GaugeVec
+	databaseTimerDuration *prometheus.Desc
 }
 
-func newExporter() *exporter {
+func newExporter(provider *statsProvider) *exporter {
 	return &exporter{
+		provider: provider,
+
+		scrapeDuration:         createExporterGauge("scrape_duration_seconds", "Duration of the last collection of RavenDB stats"),
+		snapshotAge:            createExporterGauge("snapshot_age_seconds", "Time since the served RavenDB stats were collected"),
+		lastCollectionSuccess:  createExporterGauge("last_collection_success", "Whether the last collection of RavenDB stats was successful"),
+		scrapeHTTPRequests:     createExporterGaugeVec("scrape_http_requests", "Count of HTTP requests to RavenDB made during the scrape", "code"),
+		databasesDiscovered:    createExporterGauge("databases", "Count of databases discovered during the scrape"),
+		databasesSkipped:       createExporterGauge("databases_skipped", "Count of databases skipped by the database filters"),
+		scrapeEndpointSuccess:  createDatabaseGaugeVec("scrape_endpoint_success", "Whether the RavenDB endpoint was scraped successfully", "endpoint"),
+		scrapeEndpointDuration: createDatabaseGaugeVec("scrape_endpoint_duration_seconds", "Duration of the RavenDB endpoint scrape", "endpoint"),
+
 		up:                         createGauge("up", "Whether the RavenDB scrape was successful"),
 		workingSet:                 createGauge("working_set_bytes", "Process working set"),
 		cpuTime:                    createCounter("cpu_time_seconds_total", "CPU time"),
@@ -57,22 +191,130 @@ func newExporter() *exporter {
 		mapReduceIndexMappedTotal:  createCounter("mapreduceindex_mapped_total", "Server-wide map-reduce index mapped count"),
 		mapReduceIndexReducedTotal: createCounter("mapreduceindex_reduced_total", "Server-wide map-reduce index reduced count"),
 
+		licenseInfo:                 createGaugeVec("license_info", "License type, always 1", "type"),
+		licenseExpiration:           createGauge("license_expiration_timestamp_seconds", "Expiration time of the license"),
+		licenseExpired:              createGauge("license_expired", "If 1, then the license has expired, otherwise 0"),
+		licenseMaxCores:             createGauge("license_max_cores", "Count of cores the license allows in the cluster"),
+		licenseMaxMemory:            createGauge("license_max_memory_bytes", "Memory the license allows in the cluster"),
+		licenseMaxClusterSize:       createGauge("license_max_cluster_size", "Count of nodes the license allows in the cluster"),
+		licenseUtilizedCores:        createGaugeVec("license_utilized_cores", "Count of licensed cores utilized by the cluster node given in member_node_tag", "member_node_tag"),
+		licenseClusterUtilizedCores: createGauge("license_cluster_utilized_cores", "Count of licensed cores utilized by all nodes of the cluster"),
+
+		cpuProcessTime:    createCounterVec("cpu_process_time_seconds_total", "CPU time of the process by mode", "process", "mode"),
+		cpuUsage:          createGaugeVec("cpu_usage_ratio", "CPU usage of the RavenDB process and the whole machine", "type"),
+		cpuProcessors:     createGaugeVec("cpu_processors", "Count of processors of the machine and assigned to RavenDB", "type"),
+		threadPoolThreads: createGaugeVec("thread_pool_threads", "Threads of the .NET thread pool", "pool", "type"),
+
+		memoryBytes:                createGaugeVec("memory_bytes", "Memory of the RavenDB process and the machine by type", "type"),
+		memoryLow:                  createGauge("memory_low", "If 1, then RavenDB is in the low memory state, otherwise 0"),
+		memoryThreadUnmanagedBytes: createGaugeVec("memory_thread_unmanaged_bytes", "Unmanaged memory allocated by threads of the given name", "thread"),
+
+		clusterTerm:          createGauge("cluster_term", "Current Raft term"),
+		clusterTermChanges:   createCounter("cluster_term_changes_total", "Count of Raft term changes, i.e. elections, observed by the exporter"),
+		clusterLastLogIndex:  createGauge("cluster_last_log_index", "Index of the last entry appended to the Raft log"),
+		clusterCommitIndex:   createGauge("cluster_commit_index", "Index of the last committed Raft log entry"),
+		clusterAppliedIndex:  createGauge("cluster_applied_index", "Index of the last Raft log entry applied to the cluster state"),
+		clusterCommitLag:     createGauge("cluster_commit_lag", "Count of Raft log entries appended but not committed yet"),
+		clusterApplyLag:      createGauge("cluster_apply_lag", "Count of Raft log entries committed but not applied yet"),
+		clusterState:         createGaugeVec("cluster_state", "If 1, then the node is in the given Raft state, otherwise 0", "state"),
+		clusterNodeState:     createGaugeVec("cluster_node_state", "If 1, then the cluster node given in member_node_tag has the given state in the topology, otherwise 0", "member_node_tag", "state"),
+		clusterNodeConnected: createGaugeVec("cluster_node_connected", "If 1, then the scraped node is connected to the cluster node given in member_node_tag, otherwise 0", "member_node_tag"),
+
 		databaseDocuments:    createDatabaseGaugeVec("database_documents", "Count of documents in a database"),
 		databaseIndexes:      createDatabaseGaugeVec("database_indexes", "Count of indexes in a database"),
 		databaseStaleIndexes: createDatabaseGaugeVec("database_stale_indexes", "Count of stale indexes in a database"),
 		databaseSize:         createDatabaseGaugeVec("database_size_bytes", "Database size in bytes"),
 		databaseTasks:        createDatabaseGaugeVec("database_tasks", "Tasks in a database", "type", "connection_status"),
 
+		collectionDocuments:      createDatabaseGaugeVec("collection_documents", "Count of documents in a collection", "collection"),
+		collectionSize:           createDatabaseGaugeVec("collection_size_bytes", "Total size of a collection in bytes", "collection"),
+		collectionDocumentsSize:  createDatabaseGaugeVec("collection_documents_size_bytes", "Size of documents in a collection in bytes", "collection"),
+		collectionTombstonesSize: createDatabaseGaugeVec("collection_tombstones_size_bytes", "Size of tombstones in a collection in bytes", "collection"),
+		collectionRevisionsSize:  createDatabaseGaugeVec("collection_revisions_size_bytes", "Size of revisions in a collection in bytes", "collection"),
+
+		indexState:            createIndexGaugeVec("index_state", "If 1, then index is in the given state, otherwise 0", "state"),
+		indexStale:            createIndexGaugeVec("index_stale", "If 1, then index is stale, otherwise 0"),
+		indexPriority:         createIndexGaugeVec("index_priority", "If 1, then index has the given priority, otherwise 0", "priority"),
+		indexErrors:           createIndexGaugeVec("index_errors", "Count of indexing errors"),
+		indexEntries:          createIndexGaugeVec("index_entries", "Count of index entries"),
+		indexLastIndexingAge:  createIndexGaugeVec("index_last_indexing_age_seconds", "Time since the index last indexed anything, missing if it never did"),
+		indexMappedPerSecond:  createIndexGaugeVec("index_mapped_per_second", "Rate of documents mapped by the index"),
+		indexReducedPerSecond: createIndexGaugeVec("index_reduced_per_second", "Rate of results reduced by the index"),
+
+		storageAllocated:      createStorageGaugeVec("storage_allocated_bytes", "Space allocated for the data file of a storage environment"),
+		storageUsed:           createStorageGaugeVec("storage_used_bytes", "Space used in the data file of a storage environment"),
+		storageFree:           createStorageGaugeVec("storage_free_bytes", "Free space in the data file of a storage environment"),
+		storageJournals:       createStorageGaugeVec("storage_journals_bytes", "Space allocated for journals of a storage environment"),
+		storageScratchBuffers: createStorageGaugeVec("storage_scratch_buffers_bytes", "Space allocated for scratch buffers of a storage environment"),
+
+		backupLastFull:        createBackupGaugeVec("backup_last_full_timestamp_seconds", "Time of the last full backup, 0 if there was none"),
+		backupLastIncremental: createBackupGaugeVec("backup_last_incremental_timestamp_seconds", "Time of the last incremental backup, 0 if there was none"),
+		backupNext:            createBackupGaugeVec("backup_next_timestamp_seconds", "Time of the next scheduled backup"),
+		backupLastDuration:    createBackupGaugeVec("backup_last_duration_seconds", "Duration of the last backup run"),
+		backupLastFailed:      createBackupGaugeVec("backup_last_failed", "If 1, then the last backup run failed, otherwise 0"),
+		backupDestination:     createBackupGaugeVec("backup_destination", "Destinations the backup task uploads to, always 1", "destination"),
+
+		replicationLastAcceptedEtag:        createReplicationGaugeVec("replication_last_accepted_etag", "Last etag of this database accepted by the destination"),
+		replicationLastSentEtag:            createReplicationGaugeVec("replication_last_sent_etag", "Last etag sent to the destination"),
+		replicationEtagLag:                 createReplicationGaugeVec("replication_etag_lag", "Difference between the last etag of the database and the last etag accepted by the destination"),
+		replicationLastHeartbeatAge:        createReplicationGaugeVec("replication_last_heartbeat_age_seconds", "Time since the last successful heartbeat with the destination"),
+		replicationFailing:                 createReplicationGaugeVec("replication_failing", "If 1, then replication to the destination is failing and being retried, otherwise 0"),
+		replicationIncomingLastActivityAge: createDatabaseGaugeVec("replication_incoming_last_activity_age_seconds", "Time since the last replication activity from the source", "source", "source_database"),
+
+		etlLastProcessedEtag:    createDatabaseGaugeVec("etl_last_processed_etag", "Last etag processed by the ETL transformation", etlLabels...),
+		etlDocumentsToProcess:   createDatabaseGaugeVec("etl_documents_to_process", "Count of documents left to process by the ETL transformation", etlLabels...),
+		etlTombstonesToProcess:  createDatabaseGaugeVec("etl_tombstones_to_process", "Count of document tombstones left to process by the ETL transformation", etlLabels...),
+		etlFallback:             createDatabaseGaugeVec("etl_fallback", "If 1, then the ETL transformation is throttled: it is in fallback mode after failed loads and waits before it retries, otherwise 0", etlLabels...),
+		etlLastLoadSuccessful:   createDatabaseGaugeVec("etl_last_load_successful", "If 1, then the latest load of the ETL transformation succeeded, otherwise 0", etlLabels...),
+		etlItemsExtracted:       createDatabaseGaugeVec("etl_items_extracted", "Count of items already extracted by the ETL transformation", append(etlLabels, "item_type")...),
+		etlLoadedTotal:          createDatabaseCounterVec("etl_loaded_total", "Count of items successfully loaded by the ETL transformation, not of load batches", etlLabels...),
+		etlLoadErrorsTotal:      createDatabaseCounterVec("etl_load_errors_total", "Count of items the ETL transformation failed to load, not of load batches", etlLabels...),
+		etlTransformErrorsTotal: createDatabaseCounterVec("etl_transformation_errors_total", "Count of transformation errors of the ETL transformation", etlLabels...),
+
+		subscriptionConnectedWorkers:      createDatabaseGaugeVec("subscription_connected_workers", "Count of workers connected to the subscription", "subscription"),
+		subscriptionLastAcknowledgedEtag:  createDatabaseGaugeVec("subscription_last_acknowledged_etag", "Last etag of this database acknowledged by the subscription", "subscription"),
+		subscriptionEtagLag:               createDatabaseGaugeVec("subscription_etag_lag", "Difference between the last etag of the database and the last etag acknowledged by the subscription", "subscription"),
+		subscriptionLastClientActivityAge: createDatabaseGaugeVec("subscription_last_client_activity_age_seconds", "Time since the last batch acknowledgement or connection of a subscription client", "subscription"),
+		subscriptionLastBatchDocuments:    createDatabaseGaugeVec("subscription_last_batch_documents", "Count of documents in the last batch sent to the subscription", "subscription"),
+		subscriptionLastBatchSize:         createDatabaseGaugeVec("subscription_last_batch_size_bytes", "Size of documents in the last batch sent to the subscription", "subscription"),
+		subscriptionLastBatchDuration:     createDatabaseGaugeVec("subscription_last_batch_duration_seconds", "Processing duration of the last batch sent to the subscription", "subscription"),
+
+		databaseNodeState:         createDatabaseGaugeVec("database_node_state", "If 1, then the node given in member_node_tag has the given state in the database group, otherwise 0", "member_node_tag", "state"),
+		databaseNodeHealthy:       createDatabaseGaugeVec("database_node_healthy", "If 1, then the last status of the database on the node given in member_node_tag is Ok, otherwise 0", "member_node_tag"),
+		databaseReplicationFactor: createDatabaseGaugeVec("database_replication_factor", "Intended count of nodes in the database group"),
+		databaseHealthyMembers:    createDatabaseGaugeVec("database_healthy_members", "Count of members of the database group with the Ok status"),
+		databaseDisabled:          createDatabaseGaugeVec("database_disabled", "If 1, then the database is disabled, otherwise 0"),
+		databaseEncrypted:         createDatabaseGaugeVec("database_encrypted", "If 1, then the database is encrypted, otherwise 0"),
+		databaseSharded:           createDatabaseGaugeVec("database_sharded", "If 1, then the database is sharded, otherwise 0"),
+
+		certificateExpiry: createGaugeVec("certificate_expiry_timestamp_seconds", "Expiry time of the server certificate and registered client certificates", "thumbprint", "name", "clearance", "type"),
+
 		databaseRequestTotal:               createDatabaseCounterVec("database_request_total", "Database request count"),
 		databaseDocumentPutTotal:           createDatabaseCounterVec("database_document_put_total", "Database document puts count"),
 		databaseDocumentPutBytes:           createDatabaseCounterVec("database_document_put_bytes_total", "Database document put bytes"),
 		databaseMapIndexIndexedTotal:       createDatabaseCounterVec("database_mapindex_indexed_total", "Database map index indexed count"),
 		databaseMapReduceIndexMappedTotal:  createDatabaseCounterVec("database_mapreduceindex_mapped_total", "Database map-reduce index mapped count"),
 		databaseMapReduceIndexReducedTotal: createDatabaseCounterVec("database_mapreduceindex_reduced_total", "Database map-reduce index reduced count"),
+
+		meterTotal:            createCounterVec("meter_total", "Server-wide count of events of a meter", "section", "meter"),
+		meterRate:             createGaugeVec("meter_rate", "Server-wide rate of events per second of a meter", "section", "meter", "window"),
+		timerDuration:         createDesc("timer_duration_seconds", "Server-wide duration of a timer", "section", "timer"),
+		databaseMeterTotal:    createDatabaseCounterVec("database_meter_total", "Database count of events of a meter", "section", "meter"),
+		databaseMeterRate:     createDatabaseGaugeVec("database_meter_rate", "Database rate of events per second of a meter", "section", "meter", "window"),
+		databaseTimerDuration: createDesc("database_timer_duration_seconds", "Database duration of a timer", "database", "section", "timer"),
 	}
 }
 
 func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.scrapeDuration.Desc()
+	ch <- e.snapshotAge.Desc()
+	ch <- e.lastCollectionSuccess.Desc()
+	e.scrapeHTTPRequests.Describe(ch)
+	ch <- e.databasesDiscovered.Desc()
+	ch <- e.databasesSkipped.Desc()
+	e.scrapeEndpointSuccess.Describe(ch)
+	e.scrapeEndpointDuration.Describe(ch)
+
 	ch <- e.up.Desc()
 	ch <- e.workingSet.Desc()
 	ch <- e.cpuTime.Desc()
@@ -84,296 +326,1984 @@ func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.mapReduceIndexMappedTotal.Desc()
 	ch <- e.mapReduceIndexReducedTotal.Desc()
 
+	e.licenseInfo.Describe(ch)
+	ch <- e.licenseExpiration.Desc()
+	ch <- e.licenseExpired.Desc()
+	ch <- e.licenseMaxCores.Desc()
+	ch <- e.licenseMaxMemory.Desc()
+	ch <- e.licenseMaxClusterSize.Desc()
+	e.licenseUtilizedCores.Describe(ch)
+	ch <- e.licenseClusterUtilizedCores.Desc()
+
+	e.cpuProcessTime.Describe(ch)
+	e.cpuUsage.Describe(ch)
+	e.cpuProcessors.Describe(ch)
+	e.threadPoolThreads.Describe(ch)
+
+	e.memoryBytes.Describe(ch)
+	ch <- e.memoryLow.Desc()
+	e.memoryThreadUnmanagedBytes.Describe(ch)
+
+	ch <- e.clusterTerm.Desc()
+	if e.clusterTermChanges != nil {
+		ch <- e.clusterTermChanges.Desc()
+	}
+	ch <- e.clusterLastLogIndex.Desc()
+	ch <- e.clusterCommitIndex.Desc()
+	ch <- e.clusterAppliedIndex.Desc()
+	ch <- e.clusterCommitLag.Desc()
+	ch <- e.clusterApplyLag.Desc()
+	e.clusterState.Describe(ch)
+	e.clusterNodeState.Describe(ch)
+	e.clusterNodeConnected.Describe(ch)
+
 	e.databaseDocuments.Describe(ch)
 	e.databaseIndexes.Describe(ch)
 	e.databaseStaleIndexes.Describe(ch)
 	e.databaseSize.Describe(ch)
 	e.databaseTasks.Describe(ch)
 
+	e.collectionDocuments.Describe(ch)
+	e.collectionSize.Describe(ch)
+	e.collectionDocumentsSize.Describe(ch)
+	e.collectionTombstonesSize.Describe(ch)
+	e.collectionRevisionsSize.Describe(ch)
+
+	e.indexState.Describe(ch)
+	e.indexStale.Describe(ch)
+	e.indexPriority.Describe(ch)
+	e.indexErrors.Describe(ch)
+	e.indexEntries.Describe(ch)
+	e.indexLastIndexingAge.Describe(ch)
+	e.indexMappedPerSecond.Describe(ch)
+	e.indexReducedPerSecond.Describe(ch)
+
+	e.storageAllocated.Describe(ch)
+	e.storageUsed.Describe(ch)
+	e.storageFree.Describe(ch)
+	e.storageJournals.Describe(ch)
+	e.storageScratchBuffers.Describe(ch)
+
+	e.backupLastFull.Describe(ch)
+	e.backupLastIncremental.Describe(ch)
+	e.backupNext.Describe(ch)
+	e.backupLastDuration.Describe(ch)
+	e.backupLastFailed.Describe(ch)
+	e.backupDestination.Describe(ch)
+
+	e.replicationLastAcceptedEtag.Describe(ch)
+	e.replicationLastSentEtag.Describe(ch)
+	e.replicationEtagLag.Describe(ch)
+	e.replicationLastHeartbeatAge.Describe(ch)
+	e.replicationFailing.Describe(ch)
+	e.replicationIncomingLastActivityAge.Describe(ch)
+
+	e.etlLastProcessedEtag.Describe(ch)
+	e.etlDocumentsToProcess.Describe(ch)
+	e.etlTombstonesToProcess.Describe(ch)
+	e.etlFallback.Describe(ch)
+	e.etlLastLoadSuccessful.Describe(ch)
+	e.etlItemsExtracted.Describe(ch)
+	e.etlLoadedTotal.Describe(ch)
+	e.etlLoadErrorsTotal.Describe(ch)
+	e.etlTransformErrorsTotal.Describe(ch)
+
+	e.subscriptionConnectedWorkers.Describe(ch)
+	e.subscriptionLastAcknowledgedEtag.Describe(ch)
+	e.subscriptionEtagLag.Describe(ch)
+	e.subscriptionLastClientActivityAge.Describe(ch)
+	e.subscriptionLastBatchDocuments.Describe(ch)
+	e.subscriptionLastBatchSize.Describe(ch)
+	e.subscriptionLastBatchDuration.Describe(ch)
+
+	e.databaseNodeState.Describe(ch)
+	e.databaseNodeHealthy.Describe(ch)
+	e.databaseReplicationFactor.Describe(ch)
+	e.databaseHealthyMembers.Describe(ch)
+	e.databaseDisabled.Describe(ch)
+	e.databaseEncrypted.Describe(ch)
+	e.databaseSharded.Describe(ch)
+
+	e.certificateExpiry.Describe(ch)
+
 	e.databaseRequestTotal.Describe(ch)
 	e.databaseDocumentPutTotal.Describe(ch)
+	e.databaseDocumentPutBytes.Describe(ch)
 	e.databaseMapIndexIndexedTotal.Describe(ch)
 	e.databaseMapReduceIndexMappedTotal.Describe(ch)
 	e.databaseMapReduceIndexReducedTotal.Describe(ch)
+
+	e.meterTotal.Describe(ch)
+	e.meterRate.Describe(ch)
+	ch <- e.timerDuration
+	e.databaseMeterTotal.Describe(ch)
+	e.databaseMeterRate.Describe(ch)
+	ch <- e.databaseTimerDuration
 }
 
 func (e *exporter) Collect(ch chan<- prometheus.Metric) {
-	log.Info("Running scrape")
+	snapshot := e.provider.getSnapshot()
+	stats, err := snapshot.stats, snapshot.err
+
+	// metric values are shared, so concurrent scrapes must not interleave
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 
-	if stats, err := getStats(); err != nil {
-		log.WithError(err).Error("Error while getting data from RavenDB")
+	e.scrapeDuration.Set(snapshot.duration.Seconds())
+	ch <- e.scrapeDuration
 
+	e.snapshotAge.Set(now().Sub(snapshot.collectedAt).Seconds())
+	ch <- e.snapshotAge
+
+	if err != nil {
+		e.lastCollectionSuccess.Set(0)
+	} else {
+		e.lastCollectionSuccess.Set(1)
+	}
+	ch <- e.lastCollectionSuccess
+
+	collectHTTPRequests(stats, e.scrapeHTTPRequests, ch)
+	collectEndpointResults(stats, e.scrapeEndpointSuccess, e.scrapeEndpointDuration, ch)
+
+	if err != nil {
 		e.up.Set(0)
 		ch <- e.up
 	} else {
 		e.up.Set(1)
 		ch <- e.up
 
+		e.databasesDiscovered.Set(float64(len(stats.dbStats)))
+		ch <- e.databasesDiscovered
+
+		e.databasesSkipped.Set(float64(stats.skippedDatabases))
+		ch <- e.databasesSkipped
+
+		if collectorEnabled(serverCollector) {
+			e.collectServer(stats, ch)
+		}
+		if collectorEnabled(cpuCollector) {
+			e.collectCPU(stats, ch)
+		}
+		if collectorEnabled(memoryCollector) {
+			e.collectMemory(stats, ch)
+		}
+		if collectorEnabled(licenseCollector) {
+			e.collectLicense(stats, ch)
+		}
+		if collectorEnabled(clusterCollector) {
+			e.collectCluster(stats, ch)
+		}
+		if collectorEnabled(databaseCollector) {
+			e.collectDatabases(stats, ch)
+		}
+		if collectorEnabled(meterCollector) {
+			e.collectMeters(stats, ch)
+		}
+		if collectorEnabled(tasksCollector) {
+			e.collectTasks(stats, ch)
+		}
+		if collectorEnabled(collectionCollector) {
+			e.collectCollections(stats, ch)
+		}
+		if collectorEnabled(collectionSizeCollector) {
+			e.collectCollectionSizes(stats, ch)
+		}
+		if collectorEnabled(indexCollector) {
+			e.collectIndexes(stats, ch)
+		}
+		if collectorEnabled(storageCollector) {
+			e.collectStorage(stats, ch)
+		}
+		if collectorEnabled(backupCollector) {
+			e.collectBackups(stats, ch)
+		}
+		if collectorEnabled(replicationCollector) {
+			e.collectReplication(stats, ch)
+		}
+		if collectorEnabled(etlCollector) {
+			e.collectEtl(stats, ch)
+		}
+		if collectorEnabled(subscriptionCollector) {
+			e.collectSubscriptions(stats, ch)
+		}
+		if collectorEnabled(topologyCollector) {
+			e.collectTopology(stats, ch)
+		}
+		if collectorEnabled(certificateCollector) {
+			e.collectCertificates(stats, ch)
+		}
+	}
+}
+
+func (e *exporter) collectServer(stats *stats, ch chan<- prometheus.Metric) {
+	if stats.memory != nil {
 		e.workingSet.Set(getMemoryWorkingSet(stats))
 		ch <- e.workingSet
+	}
 
+	if stats.cpu != nil {
 		e.cpuTime.Set(getCPUTime(stats))
 		ch <- e.cpuTime
+	}
 
+	if stats.nodeInfo != nil {
 		e.isLeader.Set(getIsLeader(stats))
 		ch <- e.isLeader
+	}
 
-		e.requestTotal.Set(getRequestTotal(stats))
+	if stats.metrics != nil {
+		e.requestTotal.Set(getMeterCount(stats.metrics, "Requests", "RequestsPerSec"))
 		ch <- e.requestTotal
 
-		e.documentPutTotal.Set(getDocumentPutTotal(stats))
+		e.documentPutTotal.Set(getMeterCount(stats.metrics, "Docs", "PutsPerSec"))
 		ch <- e.documentPutTotal
 
-		e.documentPutBytes.Set(getDocumentPutBytesTotal(stats))
+		e.documentPutBytes.Set(getMeterCount(stats.metrics, "Docs", "BytesPutsPerSec"))
 		ch <- e.documentPutBytes
 
-		e.mapIndexIndexedTotal.Set(getMapIndexIndexedTotal(stats))
+		e.mapIndexIndexedTotal.Set(getMeterCount(stats.metrics, "MapIndexes", "IndexedPerSec"))
 		ch <- e.mapIndexIndexedTotal
 
-		e.mapReduceIndexMappedTotal.Set(getMapReduceIndexMappedTotal(stats))
+		e.mapReduceIndexMappedTotal.Set(getMeterCount(stats.metrics, "MapReduceIndexes", "MappedPerSec"))
 		ch <- e.mapReduceIndexMappedTotal
 
-		e.mapReduceIndexReducedTotal.Set(getMapReduceIndexReducedTotal(stats))
+		e.mapReduceIndexReducedTotal.Set(getMeterCount(stats.metrics, "MapReduceIndexes", "ReducedPerSec"))
 		ch <- e.mapReduceIndexReducedTotal
+	}
+}
 
-		collectPerDatabaseGauge(stats, e.databaseDocuments, getDatabaseDocuments, ch)
-		collectPerDatabaseGauge(stats, e.databaseIndexes, getDatabaseIndexes, ch)
-		collectPerDatabaseGauge(stats, e.databaseStaleIndexes, getDatabaseStaleIndexes, ch)
-		collectPerDatabaseGauge(stats, e.databaseSize, getDatabaseSize, ch)
-		collectPerDatabaseGauge(stats, e.databaseTasks, getDatabaseTasks, ch)
-
-		collectPerDatabaseCounter(stats, e.databaseRequestTotal, getDatabaseRequestTotal, ch)
-		collectPerDatabaseCounter(stats, e.databaseDocumentPutBytes, getDatabaseDocumentPutBytes, ch)
-		collectPerDatabaseCounter(stats, e.databaseDocumentPutTotal, getDatabaseDocumentPutTotal, ch)
+func (e *exporter) collectCPU(stats *stats, ch chan<- prometheus.Metric) {
+	collectServerCounter(stats, e.cpuProcessTime, getCPUProcessTime, ch)
+	collectServerGauge(stats, e.cpuUsage, getCPUUsage, ch)
+	collectServerGauge(stats, e.cpuProcessors, getCPUProcessors, ch)
+	collectServerGauge(stats, e.threadPoolThreads, getThreadPoolThreads, ch)
+}
 
-		collectPerDatabaseCounter(stats, e.databaseMapIndexIndexedTotal, getDatabaseMapIndexIndexedTotal, ch)
-		collectPerDatabaseCounter(stats, e.databaseMapReduceIndexMappedTotal, getDatabaseMapReduceIndexMappedTotal, ch)
-		collectPerDatabaseCounter(stats, e.databaseMapReduceIndexReducedTotal, getDatabaseMapReduceIndexReducedTotal, ch)
+func (e *exporter) collectMemory(stats *stats, ch chan<- prometheus.Metric) {
+	if stats.memory != nil {
+		collectServerGauge(stats, e.memoryBytes, getMemoryBytes, ch)
+		collectServerGauge(stats, e.memoryThreadUnmanagedBytes, getMemoryThreadUnmanagedBytes, ch)
 
+		if low, ok := getMemoryLow(stats); ok {
+			e.memoryLow.Set(low)
+			ch <- e.memoryLow
+		}
 	}
 }
 
-func collectPerDatabaseGauge(stats *stats, vec *prometheus.GaugeVec, collectFunc func(*dbStats) []metricInfo, ch chan<- prometheus.Metric) {
-	vec.Reset()
-	for _, dbs := range stats.dbStats {
-		metricInfos := collectFunc(dbs)
+func (e *exporter) collectLicense(stats *stats, ch chan<- prometheus.Metric) {
+	if stats.licenseStatus != nil {
+		collectServerGauge(stats, e.licenseInfo, getLicenseInfo, ch)
 
-		for _, metricInfo := range metricInfos {
-			vec.With(metricInfo.Labels).Set(metricInfo.Value)
+		if expiration, ok := getLicenseExpiration(stats); ok {
+			e.licenseExpiration.Set(expiration)
+			ch <- e.licenseExpiration
 		}
+
+		e.licenseExpired.Set(getLicenseExpired(stats))
+		ch <- e.licenseExpired
+
+		e.licenseMaxCores.Set(getLicenseMaxCores(stats))
+		ch <- e.licenseMaxCores
+
+		e.licenseMaxMemory.Set(getLicenseMaxMemory(stats))
+		ch <- e.licenseMaxMemory
+
+		e.licenseMaxClusterSize.Set(getLicenseMaxClusterSize(stats))
+		ch <- e.licenseMaxClusterSize
+	}
+
+	if stats.clusterTopology != nil {
+		collectServerGauge(stats, e.licenseUtilizedCores, getLicenseUtilizedCores, ch)
+
+		e.licenseClusterUtilizedCores.Set(getLicenseClusterUtilizedCores(stats))
+		ch <- e.licenseClusterUtilizedCores
 	}
-	vec.Collect(ch)
 }
 
-func collectPerDatabaseCounter(stats *stats, vec *prometheus.CounterVec, collectFunc func(*dbStats) []metricInfo, ch chan<- prometheus.Metric) {
-	vec.Reset()
-	for _, dbs := range stats.dbStats {
-		metricInfos := collectFunc(dbs)
+func (e *exporter) collectCluster(stats *stats, ch chan<- prometheus.Metric) {
+	if stats.clusterTopology != nil {
+		if term, ok := getClusterTerm(stats); ok {
+			// the term increases with every election
+			if e.clusterTermChanges != nil && e.lastTerm > 0 && term > e.lastTerm {
+				e.clusterTermChanges.Add(term - e.lastTerm)
+			}
+			e.lastTerm = term
+
+			e.clusterTerm.Set(term)
+			ch <- e.clusterTerm
+		}
+		if e.clusterTermChanges != nil {
+			ch <- e.clusterTermChanges
+		}
 
-		for _, metricInfo := range metricInfos {
-			vec.With(metricInfo.Labels).Set(metricInfo.Value)
+		collectServerGauge(stats, e.clusterState, getClusterState, ch)
+		collectServerGauge(stats, e.clusterNodeState, getClusterNodeState, ch)
+		collectServerGauge(stats, e.clusterNodeConnected, getClusterNodeConnected, ch)
+	}
+
+	if stats.clusterLog != nil {
+		lastLogIndex, hasLastLogIndex := getClusterLogValue(stats, "LastLogEntryIndex")
+		commitIndex, hasCommitIndex := getClusterLogValue(stats, "CommitIndex")
+		appliedIndex, hasAppliedIndex := getClusterLogValue(stats, "LastAppliedIndex", "AppliedIndex")
+
+		if hasLastLogIndex {
+			e.clusterLastLogIndex.Set(lastLogIndex)
+			ch <- e.clusterLastLogIndex
+		}
+		if hasCommitIndex {
+			e.clusterCommitIndex.Set(commitIndex)
+			ch <- e.clusterCommitIndex
+		}
+		if hasAppliedIndex {
+			e.clusterAppliedIndex.Set(appliedIndex)
+			ch <- e.clusterAppliedIndex
+		}
+		if hasLastLogIndex && hasCommitIndex {
+			e.clusterCommitLag.Set(math.Max(lastLogIndex-commitIndex, 0))
+			ch <- e.clusterCommitLag
+		}
+		if hasCommitIndex && hasAppliedIndex {
+			e.clusterApplyLag.Set(math.Max(commitIndex-appliedIndex, 0))
+			ch <- e.clusterApplyLag
 		}
 	}
-	vec.Collect(ch)
 }
 
-func getCPUTime(stats *stats) float64 {
-	var cpuTimeString string
-	jp.ArrayEach(stats.cpu, func(value []byte, dataType jp.ValueType, offset int, err error) {
-		cpuTimeString, _ = jp.GetString(value, "TotalProcessorTime") // just use the last entry in the array TODO: why is this an array?
-	}, "CpuStats")
+func (e *exporter) collectDatabases(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.databaseDocuments, getDatabaseDocuments, ch)
+	collectPerDatabaseGauge(stats, e.databaseIndexes, getDatabaseIndexes, ch)
+	collectPerDatabaseGauge(stats, e.databaseStaleIndexes, getDatabaseStaleIndexes, ch)
+	collectPerDatabaseGauge(stats, e.databaseSize, getDatabaseSize, ch)
 
-	return timeSpanToSeconds(cpuTimeString)
-}
+	collectPerDatabaseCounter(stats, e.databaseRequestTotal, getDatabaseMeterCount("Requests", "RequestsPerSec"), ch)
+	collectPerDatabaseCounter(stats, e.databaseDocumentPutBytes, getDatabaseMeterCount("Docs", "BytesPutsPerSec"), ch)
+	collectPerDatabaseCounter(stats, e.databaseDocumentPutTotal, getDatabaseMeterCount("Docs", "PutsPerSec"), ch)
 
-func getMemoryWorkingSet(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.memory, "WorkingSet")
-	return value
+	collectPerDatabaseCounter(stats, e.databaseMapIndexIndexedTotal, getDatabaseMeterCount("MapIndexes", "IndexedPerSec"), ch)
+	collectPerDatabaseCounter(stats, e.databaseMapReduceIndexMappedTotal, getDatabaseMeterCount("MapReduceIndexes", "MappedPerSec"), ch)
+	collectPerDatabaseCounter(stats, e.databaseMapReduceIndexReducedTotal, getDatabaseMeterCount("MapReduceIndexes", "ReducedPerSec"), ch)
 }
 
-func getIsLeader(stats *stats) float64 {
-	value, _ := jp.GetString(stats.nodeInfo, "CurrentState")
-	if value == "Leader" {
-		return 1
+func (e *exporter) collectMeters(stats *stats, ch chan<- prometheus.Metric) {
+	if stats.metrics != nil {
+		collectServerCounter(stats, e.meterTotal, getMeterTotal, ch)
+		collectServerGauge(stats, e.meterRate, getMeterRate, ch)
+		collectTimers(stats.metrics, e.timerDuration, ch)
 	}
-	return 0
-}
 
-func getRequestTotal(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.metrics, "Requests", "RequestsPerSec", "Count")
-	return value
+	collectPerDatabaseCounter(stats, e.databaseMeterTotal, getDatabaseMeterTotal, ch)
+	collectPerDatabaseGauge(stats, e.databaseMeterRate, getDatabaseMeterRate, ch)
+	for _, dbs := range stats.dbStats {
+		collectTimers(dbs.metrics, e.databaseTimerDuration, ch, dbs.database)
+	}
 }
 
-func getDocumentPutTotal(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.metrics, "Docs", "PutsPerSec", "Count")
-	return value
+func (e *exporter) collectTasks(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.databaseTasks, getDatabaseTasks, ch)
 }
 
-func getDocumentPutBytesTotal(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.metrics, "Docs", "BytesPutsPerSec", "Count")
-	return value
+func (e *exporter) collectCollections(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.collectionDocuments, getCollectionDocuments, ch)
 }
 
-func getMapIndexIndexedTotal(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.metrics, "MapIndexes", "MappedPerSec", "Count")
-	return value
+func (e *exporter) collectCollectionSizes(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.collectionSize, getCollectionSize, ch)
+	collectPerDatabaseGauge(stats, e.collectionDocumentsSize, getCollectionDocumentsSize, ch)
+	collectPerDatabaseGauge(stats, e.collectionTombstonesSize, getCollectionTombstonesSize, ch)
+	collectPerDatabaseGauge(stats, e.collectionRevisionsSize, getCollectionRevisionsSize, ch)
 }
 
-func getMapReduceIndexMappedTotal(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.metrics, "MapReduceIndexes", "MappedPerSec", "Count")
-	return value
+func (e *exporter) collectIndexes(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.indexState, getIndexState, ch)
+	collectPerDatabaseGauge(stats, e.indexStale, getIndexStale, ch)
+	collectPerDatabaseGauge(stats, e.indexPriority, getIndexPriority, ch)
+	collectPerDatabaseGauge(stats, e.indexErrors, getIndexErrors, ch)
+	collectPerDatabaseGauge(stats, e.indexEntries, getIndexEntries, ch)
+	collectPerDatabaseGauge(stats, e.indexLastIndexingAge, getIndexLastIndexingAge, ch)
+	collectPerDatabaseGauge(stats, e.indexMappedPerSecond, getIndexMappedPerSecond, ch)
+	collectPerDatabaseGauge(stats, e.indexReducedPerSecond, getIndexReducedPerSecond, ch)
 }
 
-func getMapReduceIndexReducedTotal(stats *stats) float64 {
-	value, _ := jp.GetFloat(stats.metrics, "MapReduceIndexes", "ReducedPerSec", "Count")
-	return value
+func (e *exporter) collectStorage(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.storageAllocated, getStorageAllocated, ch)
+	collectPerDatabaseGauge(stats, e.storageUsed, getStorageUsed, ch)
+	collectPerDatabaseGauge(stats, e.storageFree, getStorageFree, ch)
+	collectPerDatabaseGauge(stats, e.storageJournals, getStorageJournals, ch)
+	collectPerDatabaseGauge(stats, e.storageScratchBuffers, getStorageScratchBuffers, ch)
 }
 
-func getDatabaseDocuments(dbStats *dbStats) []metricInfo {
-	var mi []metricInfo
+func (e *exporter) collectBackups(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.backupLastFull, getBackupLastFull, ch)
+	collectPerDatabaseGauge(stats, e.backupLastIncremental, getBackupLastIncremental, ch)
+	collectPerDatabaseGauge(stats, e.backupNext, getBackupNext, ch)
+	collectPerDatabaseGauge(stats, e.backupLastDuration, getBackupLastDuration, ch)
+	collectPerDatabaseGauge(stats, e.backupLastFailed, getBackupLastFailed, ch)
+	collectPerDatabaseGauge(stats, e.backupDestination, getBackupDestination, ch)
+}
 
-	value, _ := jp.GetFloat(dbStats.databaseStats, "CountOfDocuments")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+func (e *exporter) collectReplication(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.replicationLastAcceptedEtag, getReplicationLastAcceptedEtag, ch)
+	collectPerDatabaseGauge(stats, e.replicationLastSentEtag, getReplicationLastSentEtag, ch)
+	collectPerDatabaseGauge(stats, e.replicationEtagLag, getReplicationEtagLag, ch)
+	collectPerDatabaseGauge(stats, e.replicationLastHeartbeatAge, getReplicationLastHeartbeatAge, ch)
+	collectPerDatabaseGauge(stats, e.replicationFailing, getReplicationFailing, ch)
+	collectPerDatabaseGauge(stats, e.replicationIncomingLastActivityAge, getReplicationIncomingLastActivityAge, ch)
+}
 
-	return mi
+func (e *exporter) collectEtl(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.etlLastProcessedEtag, getEtlLastProcessedEtag, ch)
+	collectPerDatabaseGauge(stats, e.etlDocumentsToProcess, getEtlDocumentsToProcess, ch)
+	collectPerDatabaseGauge(stats, e.etlTombstonesToProcess, getEtlTombstonesToProcess, ch)
+	collectPerDatabaseGauge(stats, e.etlFallback, getEtlFallback, ch)
+	collectPerDatabaseGauge(stats, e.etlLastLoadSuccessful, getEtlLastLoadSuccessful, ch)
+	collectPerDatabaseGauge(stats, e.etlItemsExtracted, getEtlItemsExtracted, ch)
+
+	collectPerDatabaseCounter(stats, e.etlLoadedTotal, getEtlLoaded, ch)
+	collectPerDatabaseCounter(stats, e.etlLoadErrorsTotal, getEtlLoadErrors, ch)
+	collectPerDatabaseCounter(stats, e.etlTransformErrorsTotal, getEtlTransformationErrors, ch)
 }
 
-func getDatabaseIndexes(dbStats *dbStats) []metricInfo {
-	var mi []metricInfo
-	value, _ := jp.GetFloat(dbStats.databaseStats, "CountOfIndexes")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+func (e *exporter) collectSubscriptions(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.subscriptionConnectedWorkers, getSubscriptionConnectedWorkers, ch)
+	collectPerDatabaseGauge(stats, e.subscriptionLastAcknowledgedEtag, getSubscriptionLastAcknowledgedEtag, ch)
+	collectPerDatabaseGauge(stats, e.subscriptionEtagLag, getSubscriptionEtagLag, ch)
+	collectPerDatabaseGauge(stats, e.subscriptionLastClientActivityAge, getSubscriptionLastClientActivityAge, ch)
+	collectPerDatabaseGauge(stats, e.subscriptionLastBatchDocuments, getSubscriptionLastBatchDocuments, ch)
+	collectPerDatabaseGauge(stats, e.subscriptionLastBatchSize, getSubscriptionLastBatchSize, ch)
+	collectPerDatabaseGauge(stats, e.subscriptionLastBatchDuration, getSubscriptionLastBatchDuration, ch)
+}
 
-	return mi
+func (e *exporter) collectTopology(stats *stats, ch chan<- prometheus.Metric) {
+	collectPerDatabaseGauge(stats, e.databaseNodeState, getDatabaseNodeState, ch)
+	collectPerDatabaseGauge(stats, e.databaseNodeHealthy, getDatabaseNodeHealthy, ch)
+	collectPerDatabaseGauge(stats, e.databaseReplicationFactor, getDatabaseReplicationFactor, ch)
+	collectPerDatabaseGauge(stats, e.databaseHealthyMembers, getDatabaseHealthyMembers, ch)
+	collectPerDatabaseGauge(stats, e.databaseDisabled, getDatabaseDisabled, ch)
+	collectPerDatabaseGauge(stats, e.databaseEncrypted, getDatabaseEncrypted, ch)
+	collectPerDatabaseGauge(stats, e.databaseSharded, getDatabaseSharded, ch)
 }
 
-func getDatabaseTasks(dbStats *dbStats) []metricInfo {
-	var mi []metricInfo
+func (e *exporter) collectCertificates(stats *stats, ch chan<- prometheus.Metric) {
+	collectServerGauge(stats, e.certificateExpiry, getCertificateExpiry, ch)
+}
 
-	// Required for compatibility with versions 5 and 6
-	onGoingTasksKey := "OngoingTasks"
-	_, _, _, err := jp.Get(dbStats.tasks, onGoingTasksKey)
-	if err != nil {
-		onGoingTasksKey = "OngoingTasksList"
+func collectHTTPRequests(stats *stats, vec *prometheus.GaugeVec, ch chan<- prometheus.Metric) {
+	vec.Reset()
+	for _, result := range stats.endpoints {
+		vec.WithLabelValues(statusCodeLabel(result.statusCode)).Inc()
 	}
+	vec.Collect(ch)
+}
 
-	type key struct {
-		taskType, connectionStatus string
+func collectEndpointResults(stats *stats, successVec *prometheus.GaugeVec, durationVec *prometheus.GaugeVec, ch chan<- prometheus.Metric) {
+	successVec.Reset()
+	durationVec.Reset()
+
+	// per task endpoints are reported once per database, failing if any of the requests failed
+	failed := make(map[request]bool)
+	for _, result := range stats.endpoints {
+		key := request{endpoint: result.request.endpoint, database: result.request.database}
+		labels := prometheus.Labels{
+			"endpoint": key.endpoint,
+			"database": key.database,
+		}
+
+		if result.err != nil {
+			failed[key] = true
+		}
+		success := 1.0
+		if failed[key] {
+			success = 0
+		}
+		successVec.With(labels).Set(success)
+		durationVec.With(labels).Add(result.duration.Seconds())
 	}
+	successVec.Collect(ch)
+	durationVec.Collect(ch)
+}
 
-	taskAggregate := make(map[key]float64)
+func collectServerGauge(stats *stats, vec *prometheus.GaugeVec, collectFunc func(*stats) []metricInfo, ch chan<- prometheus.Metric) {
+	vec.Reset()
+	for _, metricInfo := range collectFunc(stats) {
+		vec.With(metricInfo.Labels).Set(metricInfo.Value)
+	}
+	vec.Collect(ch)
+}
 
-	jp.ArrayEach(dbStats.tasks, func(value []byte, dataType jp.ValueType, offset int, err error) {
-		taskType, _ := jp.GetString(value, "TaskType")
-		connectionStatus, _ := jp.GetString(value, "TaskConnectionStatus")
-		taskAggregate[key{taskType, connectionStatus}] += 1
-	}, onGoingTasksKey)
+func collectServerCounter(stats *stats, vec *prometheus.CounterVec, collectFunc func(*stats) []metricInfo, ch chan<- prometheus.Metric) {
+	vec.Reset()
+	for _, metricInfo := range collectFunc(stats) {
+		vec.With(metricInfo.Labels).Set(metricInfo.Value)
+	}
+	vec.Collect(ch)
+}
 
-	for k, v := range taskAggregate {
-		labels := generateDatabaseLabels(dbStats, map[string]string{
-			"type":              k.taskType,
-			"connection_status": k.connectionStatus,
-		})
+func collectPerDatabaseGauge(stats *stats, vec *prometheus.GaugeVec, collectFunc func(*dbStats) []metricInfo, ch chan<- prometheus.Metric) {
+	vec.Reset()
+	for _, dbs := range stats.dbStats {
+		metricInfos := collectFunc(dbs)
 
-		mi = appendMetricInfo(mi, v, labels)
+		for _, metricInfo := range metricInfos {
+			vec.With(metricInfo.Labels).Set(metricInfo.Value)
+		}
 	}
+	vec.Collect(ch)
+}
 
-	return mi
+func collectPerDatabaseCounter(stats *stats, vec *prometheus.CounterVec, collectFunc func(*dbStats) []metricInfo, ch chan<- prometheus.Metric) {
+	vec.Reset()
+	for _, dbs := range stats.dbStats {
+		metricInfos := collectFunc(dbs)
+
+		for _, metricInfo := range metricInfos {
+			vec.With(metricInfo.Labels).Set(metricInfo.Value)
+		}
+	}
+	vec.Collect(ch)
 }
 
-func getDatabaseStaleIndexes(dbStats *dbStats) []metricInfo {
-	var mi []metricInfo
+const ravenServerProcessName = "Raven.Server"
 
-	labels := generateDatabaseLabels(dbStats, nil)
-	count := 0
-	jp.ArrayEach(dbStats.databaseStats, func(value []byte, dataType jp.ValueType, offset int, err error) {
-		if isStale, _ := jp.GetBoolean(value, "IsStale"); isStale {
-			count++
+// getCPUTime reports the CPU time of the server process, or of the first entry of the CPU stats if
+// none is named Raven.Server. Every entry is exported by getCPUProcessTime
+func getCPUTime(stats *stats) float64 {
+	var cpuTimeString string
+	found := false
+	jp.ArrayEach(stats.cpu, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		if found {
+			return
 		}
-	}, "Indexes")
+		processName, _ := jp.GetString(value, "ProcessName")
+		if cpuTimeString == "" || processName == ravenServerProcessName {
+			cpuTimeString, _ = jp.GetString(value, "TotalProcessorTime")
+			found = processName == ravenServerProcessName
+		}
+	}, "CpuStats")
 
-	mi = appendMetricInfo(mi, float64(count), labels)
-	return mi
+	return timeSpanToSeconds(cpuTimeString)
 }
 
-func getDatabaseSize(dbStats *dbStats) []metricInfo {
+var cpuModes = map[string]string{"UserProcessorTime": "user", "PrivilegedProcessorTime": "privileged"}
+
+// getCPUProcessTime reads every entry of the CPU stats, which has one per process, e.g. the
+// server itself and processes it started
+func getCPUProcessTime(stats *stats) []metricInfo {
 	var mi []metricInfo
 
-	value, _ := jp.GetFloat(dbStats.databaseStats, "SizeOnDisk", "SizeInBytes")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+	jp.ArrayEach(stats.cpu, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		process, _ := jp.GetString(value, "ProcessName")
+		for key, mode := range cpuModes {
+			if timeString, err := jp.GetString(value, key); err == nil {
+				mi = appendMetricInfo(mi, timeSpanToSeconds(timeString), prometheus.Labels{"process": process, "mode": mode})
+			}
+		}
+	}, "CpuStats")
 
 	return mi
 }
 
-func getDatabaseRequestTotal(dbStats *dbStats) []metricInfo {
+// getCPUUsage reads the usage reported in percent, which is only available in the monitoring endpoint of newer versions
+func getCPUUsage(stats *stats) []metricInfo {
 	var mi []metricInfo
 
-	value, _ := jp.GetFloat(dbStats.metrics, "Requests", "RequestsPerSec", "Count")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+	for key, usageType := range map[string]string{"ProcessUsage": "process", "MachineUsage": "machine", "MachineIoWait": "machine_io_wait"} {
+		if value, err := jp.GetFloat(stats.serverMonitoring, "Cpu", key); err == nil {
+			mi = appendMetricInfo(mi, value/100, prometheus.Labels{"type": usageType})
+		}
+	}
 
 	return mi
 }
 
-func getDatabaseDocumentPutTotal(dbStats *dbStats) []metricInfo {
+func getCPUProcessors(stats *stats) []metricInfo {
 	var mi []metricInfo
 
-	value, _ := jp.GetFloat(dbStats.metrics, "Docs", "PutsPerSec", "Count")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+	for key, processorsType := range map[string]string{"ProcessorCount": "machine", "AssignedProcessorCount": "assigned"} {
+		if value, err := jp.GetFloat(stats.serverMonitoring, "Cpu", key); err == nil {
+			mi = appendMetricInfo(mi, value, prometheus.Labels{"type": processorsType})
+		}
+	}
 
 	return mi
 }
 
-func getDatabaseDocumentPutBytes(dbStats *dbStats) []metricInfo {
+var threadPoolKeys = map[string]prometheus.Labels{
+	"AvailableThreadPoolWorkerThreads":         {"pool": "worker", "type": "available"},
+	"MinThreadPoolWorkerThreads":               {"pool": "worker", "type": "min"},
+	"MaxThreadPoolWorkerThreads":               {"pool": "worker", "type": "max"},
+	"AvailableThreadPoolCompletionPortThreads": {"pool": "io", "type": "available"},
+	"MinThreadPoolCompletionPortThreads":       {"pool": "io", "type": "min"},
+	"MaxThreadPoolCompletionPortThreads":       {"pool": "io", "type": "max"},
+}
+
+// getThreadPoolThreads reads the thread pool of the CPU stats, falling back to the available
+// threads of the monitoring endpoint
+func getThreadPoolThreads(stats *stats) []metricInfo {
 	var mi []metricInfo
 
-	value, _ := jp.GetFloat(dbStats.metrics, "Docs", "BytesPutsPerSec", "Count")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+	jp.ArrayEach(stats.cpu, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		if mi != nil {
+			return
+		}
+		for key, labels := range threadPoolKeys {
+			if threads, err := jp.GetFloat(value, key); err == nil {
+				mi = appendMetricInfo(mi, threads, labels)
+			}
+		}
+	}, "ThreadPoolStats")
+
+	if mi == nil {
+		for key, pool := range map[string]string{"ThreadPoolAvailableWorkerThreads": "worker", "ThreadPoolAvailableCompletionPortThreads": "io"} {
+			if threads, err := jp.GetFloat(stats.serverMonitoring, "Cpu", key); err == nil {
+				mi = appendMetricInfo(mi, threads, prometheus.Labels{"pool": pool, "type": "available"})
+			}
+		}
+	}
 
 	return mi
 }
 
-func getDatabaseMapIndexIndexedTotal(dbStats *dbStats) []metricInfo {
+func getMemoryWorkingSet(stats *stats) float64 {
+	value, _ := jp.GetFloat(stats.memory, "WorkingSet")
+	return value
+}
+
+// memoryTypes maps the type label to the keys of the memory stats, the first one found is used
+var memoryTypes = []struct {
+	memoryType string
+	keys       []string
+}{
+	{"working_set", []string{"WorkingSet"}},
+	{"managed", []string{"ManagedAllocations"}},
+	{"unmanaged", []string{"TotalUnmanagedAllocations", "UnmanagedAllocations"}},
+	{"memory_mapped", []string{"TotalMemoryMapped", "MemoryMapped"}},
+	{"dirty", []string{"ScratchDirtyMemory", "DirtyMemory"}},
+	{"encryption_buffers", []string{"EncryptionBuffersInUse"}},
+	{"physical", []string{"PhysicalMemory", "PhysicalMem"}},
+	{"available", []string{"AvailableMemory", "FreeMem"}},
+	{"available_for_processing", []string{"AvailableMemoryForProcessing"}},
+	{"commit_charge", []string{"CurrentCommitCharge"}},
+	{"committable", []string{"TotalCommittableMemory"}},
+}
+
+func getMemoryBytes(stats *stats) []metricInfo {
 	var mi []metricInfo
 
-	value, _ := jp.GetFloat(dbStats.metrics, "MapIndexes", "IndexedPerSec", "Count")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+	for _, memoryType := range memoryTypes {
+		for _, key := range memoryType.keys {
+			if value, ok := getMemoryValue(stats, key); ok {
+				mi = appendMetricInfo(mi, value, prometheus.Labels{"type": memoryType.memoryType})
+				break
+			}
+		}
+	}
 
 	return mi
 }
 
-func getDatabaseMapReduceIndexMappedTotal(dbStats *dbStats) []metricInfo {
+// getMemoryValue reads a size of the memory stats, which is a number of bytes or a humane size
+// like "1.5 GBytes", at the top level or under "MemoryInformation" depending on the version
+func getMemoryValue(stats *stats, key string) (float64, bool) {
+	for _, keys := range [][]string{{key}, {"MemoryInformation", key}} {
+		value, dataType, _, err := jp.Get(stats.memory, keys...)
+		if err != nil {
+			continue
+		}
+		switch dataType {
+		case jp.Number:
+			if number, err := jp.ParseFloat(value); err == nil {
+				return number, true
+			}
+		case jp.String:
+			if size, ok := parseSize(string(value)); ok {
+				return size, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func getMemoryLow(stats *stats) (float64, bool) {
+	for _, keys := range [][]string{{"IsLowMemory"}, {"LowMemory"}, {"MemoryInformation", "IsLowMemory"}} {
+		if low, err := jp.GetBoolean(stats.memory, keys...); err == nil {
+			return boolToFloat(low), true
+		}
+	}
+	return 0, false
+}
+
+// getMemoryThreadUnmanagedBytes sums the allocations per thread name, as e.g. the request
+// processing threads share a name
+func getMemoryThreadUnmanagedBytes(stats *stats) []metricInfo {
 	var mi []metricInfo
 
-	value, _ := jp.GetFloat(dbStats.metrics, "MapIndexes", "MappedPerSec", "Count")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+	allocations := make(map[string]float64)
+	jp.ArrayEach(stats.memory, func(thread []byte, dataType jp.ValueType, offset int, err error) {
+		name, _ := jp.GetString(thread, "Name")
+		if value, err := jp.GetFloat(thread, "Allocations"); err == nil {
+			allocations[name] += value
+		} else if humane, err := jp.GetString(thread, "HumaneAllocations"); err == nil {
+			size, _ := parseSize(humane)
+			allocations[name] += size
+		}
+	}, "Threads")
+
+	for name, value := range allocations {
+		mi = appendMetricInfo(mi, value, prometheus.Labels{"thread": name})
+	}
 
 	return mi
 }
 
-func getDatabaseMapReduceIndexReducedTotal(dbStats *dbStats) []metricInfo {
-	var mi []metricInfo
+func getIsLeader(stats *stats) float64 {
+	value, _ := jp.GetString(stats.nodeInfo, "CurrentState")
+	if value == "Leader" {
+		return 1
+	}
+	return 0
+}
 
-	value, _ := jp.GetFloat(dbStats.metrics, "MapIndexes", "ReducedPerSec", "Count")
-	labels := generateDatabaseLabels(dbStats, nil)
-	mi = appendMetricInfo(mi, value, labels)
+// getMeterCount reads the count of a meter like Docs.PutsPerSec, or 0 if it is missing
+func getMeterCount(data []byte, section string, meter string) float64 {
+	value, _ := jp.GetFloat(data, section, meter, "Count")
+	return value
+}
 
-	return mi
+func getMeterTotal(stats *stats) []metricInfo {
+	return getMeterTotals(stats.metrics, serverLabels)
 }
 
-func createGauge(name string, help string) prometheus.Gauge {
-	return prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      name,
-		Help:      help,
-	})
+func getMeterRate(stats *stats) []metricInfo {
+	return getMeterRates(stats.metrics, serverLabels)
+}
+
+func getDatabaseMeterTotal(dbStats *dbStats) []metricInfo {
+	return getMeterTotals(dbStats.metrics, func(labels map[string]string) prometheus.Labels {
+		return generateDatabaseLabels(dbStats, labels)
+	})
+}
+
+func getDatabaseMeterRate(dbStats *dbStats) []metricInfo {
+	return getMeterRates(dbStats.metrics, func(labels map[string]string) prometheus.Labels {
+		return generateDatabaseLabels(dbStats, labels)
+	})
+}
+
+// getDatabaseMeterCount returns a getter of the count of a meter in the database metrics
+func getDatabaseMeterCount(section string, meter string) func(dbStats *dbStats) []metricInfo {
+	return func(dbStats *dbStats) []metricInfo {
+		var mi []metricInfo
+
+		value, err := jp.GetFloat(dbStats.metrics, section, meter, "Count")
+		if err != nil {
+			return mi
+		}
+		labels := generateDatabaseLabels(dbStats, nil)
+		mi = appendMetricInfo(mi, value, labels)
+
+		return mi
+	}
+}
+
+func serverLabels(labels map[string]string) prometheus.Labels {
+	return prometheus.Labels(labels)
+}
+
+// meterRates maps the rates of a meter to the window label
+var meterRates = map[string]string{
+	"Current":           "current",
+	"MeanRate":          "mean",
+	"OneMinuteRate":     "1m",
+	"FiveMinuteRate":    "5m",
+	"FifteenMinuteRate": "15m",
+}
+
+func getMeterTotals(data []byte, labelsFunc func(map[string]string) prometheus.Labels) []metricInfo {
+	var mi []metricInfo
+
+	forEachMeter(data, func(section string, name string, meter []byte) {
+		count, _ := jp.GetFloat(meter, "Count")
+		labels := labelsFunc(map[string]string{"section": section, "meter": name})
+		mi = appendMetricInfo(mi, count, labels)
+	})
+
+	return mi
+}
+
+func getMeterRates(data []byte, labelsFunc func(map[string]string) prometheus.Labels) []metricInfo {
+	var mi []metricInfo
+
+	forEachMeter(data, func(section string, name string, meter []byte) {
+		for key, window := range meterRates {
+			if rate, err := jp.GetFloat(meter, key); err == nil {
+				labels := labelsFunc(map[string]string{"section": section, "meter": name, "window": window})
+				mi = appendMetricInfo(mi, rate, labels)
+			}
+		}
+	})
+
+	return mi
+}
+
+// forEachMeter iterates the meters of the metrics endpoints, which are grouped into sections like
+// Requests or Docs. Any object with a count and a one minute rate is a meter, so meters added in
+// new RavenDB versions are picked up without changes.
+func forEachMeter(data []byte, meterFunc func(section string, name string, meter []byte)) {
+	forEachMetricsValue(data, func(section string, name string, value []byte) {
+		if _, err := jp.GetFloat(value, "Count"); err != nil {
+			return
+		}
+		if _, err := jp.GetFloat(value, "OneMinuteRate"); err != nil {
+			return
+		}
+		meterFunc(section, name, value)
+	})
+}
+
+func forEachMetricsValue(data []byte, valueFunc func(section string, name string, value []byte)) {
+	jp.ObjectEach(data, func(section []byte, sectionValue []byte, dataType jp.ValueType, offset int) error {
+		if dataType != jp.Object {
+			return nil
+		}
+		return jp.ObjectEach(sectionValue, func(name []byte, value []byte, dataType jp.ValueType, offset int) error {
+			if dataType == jp.Object {
+				valueFunc(string(section), string(name), value)
+			}
+			return nil
+		})
+	})
+}
+
+// timer is a duration histogram of the metrics endpoints, reported in milliseconds
+type timer struct {
+	count     uint64
+	sum       float64
+	quantiles map[float64]float64
+}
+
+// collectTimers sends a summary for every timer, i.e. any object with percentiles
+func collectTimers(data []byte, desc *prometheus.Desc, ch chan<- prometheus.Metric, labelValues ...string) {
+	forEachMetricsValue(data, func(section string, name string, value []byte) {
+		t, ok := getTimer(value)
+		if !ok {
+			return
+		}
+		values := append(append([]string{}, labelValues...), section, name)
+		ch <- prometheus.MustNewConstSummary(desc, t.count, t.sum, t.quantiles, values...)
+	})
+}
+
+func getTimer(value []byte) (*timer, bool) {
+	percentiles, dataType, _, err := jp.Get(value, "Percentiles")
+	if err != nil || dataType != jp.Object {
+		return nil, false
+	}
+
+	count, _ := jp.GetFloat(value, "Count")
+	t := &timer{
+		count:     uint64(count),
+		quantiles: make(map[float64]float64),
+	}
+	if sum, err := jp.GetFloat(value, "Sum"); err == nil {
+		t.sum = sum / 1000
+	} else {
+		mean, _ := jp.GetFloat(value, "Mean")
+		t.sum = mean * count / 1000
+	}
+
+	jp.ObjectEach(percentiles, func(key []byte, value []byte, dataType jp.ValueType, offset int) error {
+		if quantile, ok := parseQuantile(string(key)); ok {
+			if duration, err := jp.ParseFloat(value); err == nil {
+				t.quantiles[quantile] = duration / 1000
+			}
+		}
+		return nil
+	})
+
+	return t, true
+}
+
+// parseQuantile converts percentile keys like "P99", "99.9" or "0.5" to a quantile
+func parseQuantile(key string) (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimLeft(key, "pP"), "%"), 64)
+	if err != nil || value < 0 || value > 100 {
+		return 0, false
+	}
+	if value > 1 {
+		value = value / 100
+	}
+	return value, true
+}
+
+// getCertificateExpiry reads the certificates registered in the cluster, and adds the certificate
+// the server presented if it is not registered, which is the case for the server certificate
+func getCertificateExpiry(stats *stats) []metricInfo {
+	var mi []metricInfo
+
+	thumbprints := make(map[string]bool)
+	jp.ArrayEach(stats.certificates, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		thumbprint, _ := jp.GetString(value, "Thumbprint")
+		name, _ := jp.GetString(value, "Name")
+		clearance, _ := jp.GetString(value, "SecurityClearance")
+		notAfter, _ := jp.GetString(value, "NotAfter")
+
+		expiry, ok := parseTime(notAfter)
+		if !ok || thumbprints[thumbprint] {
+			return
+		}
+		thumbprints[thumbprint] = true
+
+		mi = appendMetricInfo(mi, float64(expiry.Unix()), prometheus.Labels{
+			"thumbprint": thumbprint,
+			"name":       name,
+			"clearance":  clearance,
+			"type":       certificateType(clearance),
+		})
+	}, "Results")
+
+	if cert := stats.serverCertificate; cert != nil {
+		thumbprint := fmt.Sprintf("%X", sha1.Sum(cert.Raw))
+		if !thumbprints[thumbprint] {
+			mi = appendMetricInfo(mi, float64(cert.NotAfter.Unix()), prometheus.Labels{
+				"thumbprint": thumbprint,
+				"name":       cert.Subject.CommonName,
+				"clearance":  clusterNodeClearance,
+				"type":       certificateType(clusterNodeClearance),
+			})
+		}
+	}
+
+	return mi
+}
+
+func certificateType(clearance string) string {
+	if clearance == clusterNodeClearance {
+		return "server"
+	}
+	return "client"
+}
+
+func getLicenseInfo(stats *stats) []metricInfo {
+	licenseType, _ := jp.GetString(stats.licenseStatus, "Type")
+	return appendMetricInfo(nil, 1, prometheus.Labels{"type": licenseType})
+}
+
+func getLicenseExpiration(stats *stats) (float64, bool) {
+	expiration, _ := jp.GetString(stats.licenseStatus, "Expiration")
+	t, ok := parseTime(expiration)
+	return float64(t.Unix()), ok
+}
+
+func getLicenseExpired(stats *stats) float64 {
+	if expired, _ := jp.GetBoolean(stats.licenseStatus, "Expired"); expired {
+		return 1
+	}
+	return 0
+}
+
+func getLicenseMaxCores(stats *stats) float64 {
+	value, _ := jp.GetFloat(stats.licenseStatus, "MaxCores")
+	return value
+}
+
+// getLicenseMaxMemory converts the licensed memory from GB
+func getLicenseMaxMemory(stats *stats) float64 {
+	value, _ := jp.GetFloat(stats.licenseStatus, "MaxMemory")
+	return value * 1024 * 1024 * 1024
+}
+
+func getLicenseMaxClusterSize(stats *stats) float64 {
+	value, _ := jp.GetFloat(stats.licenseStatus, "MaxClusterSize")
+	return value
+}
+
+func getLicenseUtilizedCores(stats *stats) []metricInfo {
+	var mi []metricInfo
+
+	jp.ObjectEach(stats.clusterTopology, func(key []byte, value []byte, dataType jp.ValueType, offset int) error {
+		if cores, err := jp.GetFloat(value, "UtilizedCores"); err == nil {
+			mi = appendMetricInfo(mi, cores, prometheus.Labels{"member_node_tag": string(key)})
+		}
+		return nil
+	}, "NodeLicenseDetails")
+
+	return mi
+}
+
+func getLicenseClusterUtilizedCores(stats *stats) float64 {
+	total := 0.0
+	for _, mi := range getLicenseUtilizedCores(stats) {
+		total += mi.Value
+	}
+	return total
+}
+
+var (
+	clusterStates     = []string{"Passive", "Candidate", "Follower", "LeaderElect", "Leader"}
+	clusterNodeStates = map[string]string{"Members": "Member", "Promotables": "Promotable", "Watchers": "Watcher"}
+)
+
+func getClusterTerm(stats *stats) (float64, bool) {
+	term, err := jp.GetFloat(stats.clusterTopology, "CurrentTerm")
+	return term, err == nil
+}
+
+func getClusterState(stats *stats) []metricInfo {
+	var mi []metricInfo
+
+	current, _ := jp.GetString(stats.clusterTopology, "CurrentState")
+	for _, state := range clusterStates {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+		mi = appendMetricInfo(mi, value, prometheus.Labels{"state": state})
+	}
+
+	return mi
+}
+
+// getClusterNodeState reports the role of every node in the topology, a node which is not part of a
+// cluster is passive
+func getClusterNodeState(stats *stats) []metricInfo {
+	var mi []metricInfo
+
+	nodeStates := make(map[string]string)
+	for section, state := range clusterNodeStates {
+		jp.ObjectEach(stats.clusterTopology, func(key []byte, value []byte, dataType jp.ValueType, offset int) error {
+			nodeStates[string(key)] = state
+			return nil
+		}, "Topology", section)
+	}
+	if current, _ := jp.GetString(stats.clusterTopology, "CurrentState"); current == "Passive" {
+		nodeTag, _ := jp.GetString(stats.clusterTopology, "NodeTag")
+		nodeStates[nodeTag] = "Passive"
+	}
+
+	for nodeTag, current := range nodeStates {
+		for _, state := range []string{"Member", "Promotable", "Watcher", "Passive"} {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			mi = appendMetricInfo(mi, value, prometheus.Labels{"member_node_tag": nodeTag, "state": state})
+		}
+	}
+
+	return mi
+}
+
+func getClusterNodeConnected(stats *stats) []metricInfo {
+	var mi []metricInfo
+
+	jp.ObjectEach(stats.clusterTopology, func(key []byte, value []byte, dataType jp.ValueType, offset int) error {
+		connected := 0.0
+		if value, _ := jp.GetBoolean(value, "Connected"); value {
+			connected = 1
+		}
+		mi = appendMetricInfo(mi, connected, prometheus.Labels{"member_node_tag": string(key)})
+		return nil
+	}, "Status")
+
+	return mi
+}
+
+// getClusterLogValue reads the first of the keys found in the Raft log debug info, which is nested
+// under "Log" in newer versions
+func getClusterLogValue(stats *stats, keys ...string) (float64, bool) {
+	for _, key := range keys {
+		if value, err := jp.GetFloat(stats.clusterLog, key); err == nil {
+			return value, true
+		}
+		if value, err := jp.GetFloat(stats.clusterLog, "Log", key); err == nil {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+func getDatabaseDocuments(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	value, err := jp.GetFloat(dbStats.databaseStats, "CountOfDocuments")
+	if err != nil {
+		return mi
+	}
+	labels := generateDatabaseLabels(dbStats, nil)
+	mi = appendMetricInfo(mi, value, labels)
+
+	return mi
+}
+
+func getDatabaseIndexes(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+	value, err := jp.GetFloat(dbStats.databaseStats, "CountOfIndexes")
+	if err != nil {
+		return mi
+	}
+	labels := generateDatabaseLabels(dbStats, nil)
+	mi = appendMetricInfo(mi, value, labels)
+
+	return mi
+}
+
+func getDatabaseTasks(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	type key struct {
+		taskType, connectionStatus string
+	}
+
+	taskAggregate := make(map[key]float64)
+
+	forEachOngoingTask(dbStats.tasks, func(task []byte) {
+		taskType, _ := jp.GetString(task, "TaskType")
+		connectionStatus, _ := jp.GetString(task, "TaskConnectionStatus")
+		taskAggregate[key{taskType, connectionStatus}] += 1
+	})
+
+	for k, v := range taskAggregate {
+		labels := generateDatabaseLabels(dbStats, map[string]string{
+			"type":              k.taskType,
+			"connection_status": k.connectionStatus,
+		})
+
+		mi = appendMetricInfo(mi, v, labels)
+	}
+
+	return mi
+}
+
+func getDatabaseStaleIndexes(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	if dbStats.databaseStats == nil {
+		return mi
+	}
+
+	labels := generateDatabaseLabels(dbStats, nil)
+	count := 0
+	jp.ArrayEach(dbStats.databaseStats, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		if isStale, _ := jp.GetBoolean(value, "IsStale"); isStale {
+			count++
+		}
+	}, "Indexes")
+
+	mi = appendMetricInfo(mi, float64(count), labels)
+	return mi
+}
+
+func getDatabaseSize(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	value, err := jp.GetFloat(dbStats.databaseStats, "SizeOnDisk", "SizeInBytes")
+	if err != nil {
+		return mi
+	}
+	labels := generateDatabaseLabels(dbStats, nil)
+	mi = appendMetricInfo(mi, value, labels)
+
+	return mi
+}
+
+// getCollectionDocuments reads the collection stats, which map every collection to its count of documents
+func getCollectionDocuments(dbStats *dbStats) []metricInfo {
+	return getCollectionValues(dbStats, dbStats.collectionStats)
+}
+
+func getCollectionSize(dbStats *dbStats) []metricInfo {
+	return getCollectionValues(dbStats, dbStats.collectionSizes, "Size", "SizeInBytes")
+}
+
+func getCollectionDocumentsSize(dbStats *dbStats) []metricInfo {
+	return getCollectionValues(dbStats, dbStats.collectionSizes, "DocumentsSize", "SizeInBytes")
+}
+
+func getCollectionTombstonesSize(dbStats *dbStats) []metricInfo {
+	return getCollectionValues(dbStats, dbStats.collectionSizes, "TombstonesSize", "SizeInBytes")
+}
+
+func getCollectionRevisionsSize(dbStats *dbStats) []metricInfo {
+	return getCollectionValues(dbStats, dbStats.collectionSizes, "RevisionsSize", "SizeInBytes")
+}
+
+func getCollectionValues(dbStats *dbStats, data []byte, keys ...string) []metricInfo {
+	var mi []metricInfo
+
+	jp.ObjectEach(data, func(key []byte, value []byte, dataType jp.ValueType, offset int) error {
+		collectionValue, _ := jp.GetFloat(value, keys...)
+		labels := generateDatabaseLabels(dbStats, map[string]string{
+			"collection": string(key),
+		})
+		mi = appendMetricInfo(mi, collectionValue, labels)
+		return nil
+	}, "Collections")
+
+	return mi
+}
+
+var (
+	indexStates     = []string{"Normal", "Error", "Disabled", "Idle"}
+	indexPriorities = []string{"Low", "Normal", "High"}
+)
+
+func getIndexState(dbStats *dbStats) []metricInfo {
+	return getIndexStateSet(dbStats, "State", "state", indexStates)
+}
+
+func getIndexStale(dbStats *dbStats) []metricInfo {
+	return getIndexValues(dbStats, func(index []byte) (float64, bool) {
+		if isStale, _ := jp.GetBoolean(index, "IsStale"); isStale {
+			return 1, true
+		}
+		return 0, true
+	})
+}
+
+func getIndexPriority(dbStats *dbStats) []metricInfo {
+	return getIndexStateSet(dbStats, "Priority", "priority", indexPriorities)
+}
+
+func getIndexErrors(dbStats *dbStats) []metricInfo {
+	return getIndexValues(dbStats, func(index []byte) (float64, bool) {
+		value, _ := jp.GetFloat(index, "ErrorsCount")
+		return value, true
+	})
+}
+
+func getIndexEntries(dbStats *dbStats) []metricInfo {
+	return getIndexValues(dbStats, func(index []byte) (float64, bool) {
+		value, _ := jp.GetFloat(index, "EntriesCount")
+		return value, true
+	})
+}
+
+func getIndexLastIndexingAge(dbStats *dbStats) []metricInfo {
+	return getIndexValues(dbStats, func(index []byte) (float64, bool) {
+		value, _ := jp.GetString(index, "LastIndexingTime")
+		return ageInSeconds(value)
+	})
+}
+
+func getIndexMappedPerSecond(dbStats *dbStats) []metricInfo {
+	return getIndexValues(dbStats, func(index []byte) (float64, bool) {
+		value, _ := jp.GetFloat(index, "MappedPerSecondRate")
+		return value, true
+	})
+}
+
+func getIndexReducedPerSecond(dbStats *dbStats) []metricInfo {
+	return getIndexValues(dbStats, func(index []byte) (float64, bool) {
+		value, _ := jp.GetFloat(index, "ReducedPerSecondRate")
+		return value, true
+	})
+}
+
+func getIndexValues(dbStats *dbStats, valueFunc func(index []byte) (float64, bool)) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(dbStats.indexes, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		if indexValue, ok := valueFunc(value); ok {
+			mi = appendMetricInfo(mi, indexValue, generateIndexLabels(dbStats, value, nil))
+		}
+	}, "Results")
+
+	return mi
+}
+
+func getIndexStateSet(dbStats *dbStats, key string, labelName string, states []string) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(dbStats.indexes, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		current, _ := jp.GetString(value, key)
+		for _, state := range states {
+			var isCurrent float64
+			if state == current {
+				isCurrent = 1
+			}
+			labels := generateIndexLabels(dbStats, value, map[string]string{labelName: state})
+			mi = appendMetricInfo(mi, isCurrent, labels)
+		}
+	}, "Results")
+
+	return mi
+}
+
+func getStorageAllocated(dbStats *dbStats) []metricInfo {
+	return getStorageValues(dbStats, func(report []byte) float64 {
+		value, _ := jp.GetFloat(report, "DataFile", "AllocatedSpaceInBytes")
+		return value
+	})
+}
+
+func getStorageUsed(dbStats *dbStats) []metricInfo {
+	return getStorageValues(dbStats, func(report []byte) float64 {
+		value, _ := jp.GetFloat(report, "DataFile", "UsedSpaceInBytes")
+		return value
+	})
+}
+
+func getStorageFree(dbStats *dbStats) []metricInfo {
+	return getStorageValues(dbStats, func(report []byte) float64 {
+		value, _ := jp.GetFloat(report, "DataFile", "FreeSpaceInBytes")
+		return value
+	})
+}
+
+func getStorageJournals(dbStats *dbStats) []metricInfo {
+	return getStorageValues(dbStats, func(report []byte) float64 {
+		var total float64
+		jp.ArrayEach(report, func(value []byte, dataType jp.ValueType, offset int, err error) {
+			size, _ := jp.GetFloat(value, "AllocatedSpaceInBytes")
+			total += size
+		}, "Journals")
+		return total
+	})
+}
+
+func getStorageScratchBuffers(dbStats *dbStats) []metricInfo {
+	return getStorageValues(dbStats, func(report []byte) float64 {
+		var total float64
+		jp.ArrayEach(report, func(value []byte, dataType jp.ValueType, offset int, err error) {
+			if tempType, _ := jp.GetString(value, "Type"); tempType == "Scratch" {
+				size, _ := jp.GetFloat(value, "AllocatedSpaceInBytes")
+				total += size
+			}
+		}, "TempFiles")
+		return total
+	})
+}
+
+func getStorageValues(dbStats *dbStats, valueFunc func(report []byte) float64) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(dbStats.storage, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		environment, _ := jp.GetString(value, "Name")
+		environmentType, _ := jp.GetString(value, "Type")
+		report, _, _, _ := jp.Get(value, "Report")
+
+		labels := generateDatabaseLabels(dbStats, map[string]string{
+			"environment": environment,
+			"type":        environmentType,
+		})
+		mi = appendMetricInfo(mi, valueFunc(report), labels)
+	}, "Results")
+
+	return mi
+}
+
+func getBackupLastFull(dbStats *dbStats) []metricInfo {
+	return getBackupValues(dbStats, func(task []byte, status []byte) (float64, bool) {
+		return timestampInSeconds(lastBackup(task, status, "LastFullBackup")), true
+	})
+}
+
+func getBackupLastIncremental(dbStats *dbStats) []metricInfo {
+	return getBackupValues(dbStats, func(task []byte, status []byte) (float64, bool) {
+		return timestampInSeconds(lastBackup(task, status, "LastIncrementalBackup")), true
+	})
+}
+
+func getBackupNext(dbStats *dbStats) []metricInfo {
+	return getBackupValues(dbStats, func(task []byte, status []byte) (float64, bool) {
+		next, _ := jp.GetString(task, "NextBackup", "DateTime")
+		t, ok := parseTime(next)
+		return float64(t.Unix()), ok
+	})
+}
+
+func getBackupLastDuration(dbStats *dbStats) []metricInfo {
+	return getBackupValues(dbStats, func(task []byte, status []byte) (float64, bool) {
+		duration, err := jp.GetFloat(status, "Status", "DurationInMs")
+		return duration / 1000, err == nil
+	})
+}
+
+// getBackupLastFailed reports a failure if the last error happened after the last successful backup
+func getBackupLastFailed(dbStats *dbStats) []metricInfo {
+	return getBackupValues(dbStats, func(task []byte, status []byte) (float64, bool) {
+		if status == nil {
+			return 0, false
+		}
+
+		errorAt, _ := jp.GetString(status, "Status", "Error", "At")
+		failedAt, failed := parseTime(errorAt)
+		if !failed {
+			return 0, true
+		}
+
+		for _, key := range []string{"LastFullBackup", "LastIncrementalBackup"} {
+			succeeded, _ := jp.GetString(status, "Status", key)
+			if succeededAt, ok := parseTime(succeeded); ok && !succeededAt.Before(failedAt) {
+				return 0, true
+			}
+		}
+		return 1, true
+	})
+}
+
+func getBackupDestination(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	forEachBackupTask(dbStats, func(task []byte, status []byte) {
+		jp.ArrayEach(task, func(value []byte, dataType jp.ValueType, offset int, err error) {
+			labels := generateBackupLabels(dbStats, task, map[string]string{"destination": string(value)})
+			mi = appendMetricInfo(mi, 1, labels)
+		}, "BackupDestinations")
+	})
+
+	return mi
+}
+
+func getBackupValues(dbStats *dbStats, valueFunc func(task []byte, status []byte) (float64, bool)) []metricInfo {
+	var mi []metricInfo
+
+	forEachBackupTask(dbStats, func(task []byte, status []byte) {
+		if value, ok := valueFunc(task, status); ok {
+			mi = appendMetricInfo(mi, value, generateBackupLabels(dbStats, task, nil))
+		}
+	})
+
+	return mi
+}
+
+// forEachBackupTask calls the function for every periodic backup task, with its status if it was retrieved
+func forEachBackupTask(dbStats *dbStats, taskFunc func(task []byte, status []byte)) {
+	forEachOngoingTask(dbStats.tasks, func(task []byte) {
+		if taskType, _ := jp.GetString(task, "TaskType"); taskType != backupTaskType {
+			return
+		}
+		taskID, _ := jp.GetInt(task, "TaskId")
+		taskFunc(task, dbStats.backupStatuses[strconv.FormatInt(taskID, 10)])
+	})
+}
+
+// lastBackup reads the time of the last backup from the task, or from the backup status for older servers
+func lastBackup(task []byte, status []byte, key string) string {
+	if value, err := jp.GetString(task, key); err == nil && value != "" {
+		return value
+	}
+	value, _ := jp.GetString(status, "Status", key)
+	return value
+}
+
+func getReplicationLastAcceptedEtag(dbStats *dbStats) []metricInfo {
+	return getOutgoingReplicationValues(dbStats, func(handler []byte) (float64, bool) {
+		return getAcceptedEtag(dbStats, handler)
+	})
+}
+
+func getReplicationLastSentEtag(dbStats *dbStats) []metricInfo {
+	return getOutgoingReplicationValues(dbStats, func(handler []byte) (float64, bool) {
+		etag, err := jp.GetFloat(handler, "LastSentEtag")
+		return etag, err == nil
+	})
+}
+
+func getReplicationEtagLag(dbStats *dbStats) []metricInfo {
+	return getOutgoingReplicationValues(dbStats, func(handler []byte) (float64, bool) {
+		lastEtag, err := jp.GetFloat(dbStats.databaseStats, "LastDocEtag")
+		if err != nil {
+			return 0, false
+		}
+		acceptedEtag, ok := getAcceptedEtag(dbStats, handler)
+		if !ok {
+			return 0, false
+		}
+		return math.Max(lastEtag-acceptedEtag, 0), true
+	})
+}
+
+func getReplicationLastHeartbeatAge(dbStats *dbStats) []metricInfo {
+	return getOutgoingReplicationValues(dbStats, func(handler []byte) (float64, bool) {
+		ticks, err := jp.GetInt(handler, "LastHeartbeatTicks")
+		if err != nil || ticks <= 0 {
+			return 0, false
+		}
+		return now().Sub(ticksToTime(ticks)).Seconds(), true
+	})
+}
+
+// getReplicationFailing reports destinations which are being retried after a failure, including
+// the ones a connection could not be established with, as well as connected destinations
+func getReplicationFailing(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	failing := make(map[string]bool)
+	jp.ArrayEach(dbStats.replicationFailures, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		node, _, _, _ := jp.Get(value, "Key")
+		failed := 1.0
+		if retries, err := jp.GetInt(value, "Value", "RetriesCount"); err == nil && retries == 0 {
+			failed = 0
+		}
+
+		labels := generateReplicationLabels(dbStats, node)
+		failing[labels["destination"]+"/"+labels["destination_database"]] = true
+		mi = appendMetricInfo(mi, failed, labels)
+	}, "Stats")
+
+	forEachOutgoingReplication(dbStats, func(handler []byte, labels prometheus.Labels) {
+		if !failing[labels["destination"]+"/"+labels["destination_database"]] {
+			mi = appendMetricInfo(mi, 0, labels)
+		}
+	})
+
+	return mi
+}
+
+func getReplicationIncomingLastActivityAge(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(dbStats.replicationIncoming, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		source, _ := jp.GetString(value, "Key", "SourceUrl")
+		sourceDatabase, _ := jp.GetString(value, "Key", "SourceDatabaseName")
+		lastActivity, _ := jp.GetString(value, "Value")
+		age, ok := ageInSeconds(lastActivity)
+		if !ok {
+			return
+		}
+
+		labels := generateDatabaseLabels(dbStats, map[string]string{
+			"source":          source,
+			"source_database": sourceDatabase,
+		})
+		mi = appendMetricInfo(mi, age, labels)
+	}, "Stats")
+
+	return mi
+}
+
+// getAcceptedEtag reads the etag of this database from the change vector accepted by the destination
+func getAcceptedEtag(dbStats *dbStats, handler []byte) (float64, bool) {
+	databaseID, err := jp.GetString(dbStats.databaseStats, "DatabaseId")
+	if err != nil {
+		return 0, false
+	}
+	changeVector, err := jp.GetString(handler, "LastAcceptedChangeVector")
+	if err != nil {
+		return 0, false
+	}
+	return float64(changeVectorEtag(changeVector, databaseID)), true
+}
+
+func getOutgoingReplicationValues(dbStats *dbStats, valueFunc func(handler []byte) (float64, bool)) []metricInfo {
+	var mi []metricInfo
+
+	forEachOutgoingReplication(dbStats, func(handler []byte, labels prometheus.Labels) {
+		if value, ok := valueFunc(handler); ok {
+			mi = appendMetricInfo(mi, value, labels)
+		}
+	})
+
+	return mi
+}
+
+func forEachOutgoingReplication(dbStats *dbStats, handlerFunc func(handler []byte, labels prometheus.Labels)) {
+	jp.ArrayEach(dbStats.replicationOutgoing, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		node, _, _, _ := jp.Get(value, "Destination")
+		handlerFunc(value, generateReplicationLabels(dbStats, node))
+	}, "Stats")
+}
+
+func getEtlLastProcessedEtag(dbStats *dbStats) []metricInfo {
+	return getEtlStatisticsValues(dbStats, "LastProcessedEtag")
+}
+
+func getEtlLoaded(dbStats *dbStats) []metricInfo {
+	return getEtlStatisticsValues(dbStats, "LoadSuccesses")
+}
+
+func getEtlLoadErrors(dbStats *dbStats) []metricInfo {
+	return getEtlStatisticsValues(dbStats, "LoadErrors")
+}
+
+func getEtlTransformationErrors(dbStats *dbStats) []metricInfo {
+	return getEtlStatisticsValues(dbStats, "TransformationErrors")
+}
+
+func getEtlFallback(dbStats *dbStats) []metricInfo {
+	return getEtlValues(dbStats, dbStats.etlStats, "Stats", func(process []byte) (float64, bool) {
+		fallback, err := jp.GetString(process, "Statistics", "FallbackTime")
+		return boolToFloat(err == nil && fallback != ""), true
+	})
+}
+
+func getEtlLastLoadSuccessful(dbStats *dbStats) []metricInfo {
+	return getEtlValues(dbStats, dbStats.etlStats, "Stats", func(process []byte) (float64, bool) {
+		successful, err := jp.GetBoolean(process, "Statistics", "WasLatestLoadSuccessful")
+		return boolToFloat(successful), err == nil
+	})
+}
+
+// etlItemTypes lists the item types of the ETL progress with their total and left to process keys
+var etlItemTypes = []struct {
+	name         string
+	totalKey     string
+	toProcessKey string
+}{
+	{"documents", "TotalNumberOfDocuments", "NumberOfDocumentsToProcess"},
+	{"document_tombstones", "TotalNumberOfDocumentTombstones", "NumberOfDocumentTombstonesToProcess"},
+	{"counter_groups", "TotalNumberOfCounterGroups", "NumberOfCounterGroupsToProcess"},
+	{"time_series_segments", "TotalNumberOfTimeSeriesSegments", "NumberOfTimeSeriesSegmentsToProcess"},
+}
+
+func getEtlItemsExtracted(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	for _, itemType := range etlItemTypes {
+		values := getEtlValues(dbStats, dbStats.etlProgress, "ProcessesProgress", func(process []byte) (float64, bool) {
+			return getEtlExtracted(process, itemType.totalKey, itemType.toProcessKey)
+		})
+		for _, value := range values {
+			value.Labels["item_type"] = itemType.name
+			mi = append(mi, value)
+		}
+	}
+
+	return mi
+}
+
+func getEtlExtracted(process []byte, totalKey string, toProcessKey string) (float64, bool) {
+	total, err := jp.GetFloat(process, totalKey)
+	if err != nil {
+		return 0, false
+	}
+	toProcess, err := jp.GetFloat(process, toProcessKey)
+	if err != nil {
+		return 0, false
+	}
+	return total - toProcess, true
+}
+
+func getEtlDocumentsToProcess(dbStats *dbStats) []metricInfo {
+	return getEtlProgressValues(dbStats, "NumberOfDocumentsToProcess")
+}
+
+func getEtlTombstonesToProcess(dbStats *dbStats) []metricInfo {
+	return getEtlProgressValues(dbStats, "NumberOfDocumentTombstonesToProcess")
+}
+
+func getEtlStatisticsValues(dbStats *dbStats, key string) []metricInfo {
+	return getEtlValues(dbStats, dbStats.etlStats, "Stats", func(process []byte) (float64, bool) {
+		value, err := jp.GetFloat(process, "Statistics", key)
+		return value, err == nil
+	})
+}
+
+func getEtlProgressValues(dbStats *dbStats, key string) []metricInfo {
+	return getEtlValues(dbStats, dbStats.etlProgress, "ProcessesProgress", func(process []byte) (float64, bool) {
+		value, err := jp.GetFloat(process, key)
+		return value, err == nil
+	})
+}
+
+// getEtlValues iterates the ETL processes, one per task and transformation, of the ETL stats or progress response
+func getEtlValues(dbStats *dbStats, data []byte, processesKey string, valueFunc func(process []byte) (float64, bool)) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(data, func(task []byte, dataType jp.ValueType, offset int, err error) {
+		jp.ArrayEach(task, func(process []byte, dataType jp.ValueType, offset int, err error) {
+			if value, ok := valueFunc(process); ok {
+				mi = appendMetricInfo(mi, value, generateEtlLabels(dbStats, task, process))
+			}
+		}, processesKey)
+	}, "Results")
+
+	return mi
+}
+
+func getSubscriptionConnectedWorkers(dbStats *dbStats) []metricInfo {
+	return getSubscriptionValues(dbStats, func(name string, subscription []byte) (float64, bool) {
+		connections, ok := dbStats.subscriptionConnections[name]
+		if !ok {
+			return 0, false
+		}
+
+		workers := 0.0
+		jp.ArrayEach(connections, func(value []byte, dataType jp.ValueType, offset int, err error) {
+			workers++
+		}, "Results")
+		return workers, true
+	})
+}
+
+func getSubscriptionLastAcknowledgedEtag(dbStats *dbStats) []metricInfo {
+	return getSubscriptionValues(dbStats, func(name string, subscription []byte) (float64, bool) {
+		return getAcknowledgedEtag(dbStats, subscription)
+	})
+}
+
+func getSubscriptionEtagLag(dbStats *dbStats) []metricInfo {
+	return getSubscriptionValues(dbStats, func(name string, subscription []byte) (float64, bool) {
+		lastEtag, err := jp.GetFloat(dbStats.databaseStats, "LastDocEtag")
+		if err != nil {
+			return 0, false
+		}
+		acknowledgedEtag, ok := getAcknowledgedEtag(dbStats, subscription)
+		if !ok {
+			return 0, false
+		}
+		return math.Max(lastEtag-acknowledgedEtag, 0), true
+	})
+}
+
+func getSubscriptionLastClientActivityAge(dbStats *dbStats) []metricInfo {
+	return getSubscriptionValues(dbStats, func(name string, subscription []byte) (float64, bool) {
+		var lastActivity time.Time
+		for _, key := range []string{"LastBatchAckTime", "LastClientConnectionTime"} {
+			timestamp, _ := jp.GetString(subscription, key)
+			if t, ok := parseTime(timestamp); ok && t.After(lastActivity) {
+				lastActivity = t
+			}
+		}
+		if lastActivity.IsZero() {
+			return 0, false
+		}
+		return now().Sub(lastActivity).Seconds(), true
+	})
+}
+
+func getSubscriptionLastBatchDocuments(dbStats *dbStats) []metricInfo {
+	return getSubscriptionBatchValues(dbStats, func(batch []byte) float64 {
+		value, _ := jp.GetFloat(batch, "NumberOfDocuments")
+		return value
+	})
+}
+
+func getSubscriptionLastBatchSize(dbStats *dbStats) []metricInfo {
+	return getSubscriptionBatchValues(dbStats, func(batch []byte) float64 {
+		value, err := jp.GetFloat(batch, "SizeOfDocumentsInBytes")
+		if err != nil {
+			value, _ = jp.GetFloat(batch, "SizeOfDocuments")
+		}
+		return value
+	})
+}
+
+func getSubscriptionLastBatchDuration(dbStats *dbStats) []metricInfo {
+	return getSubscriptionBatchValues(dbStats, func(batch []byte) float64 {
+		value, _ := jp.GetFloat(batch, "DurationInMs")
+		return value / 1000
+	})
+}
+
+// getAcknowledgedEtag reads the etag of this database from the change vector the next batch of the subscription starts from
+func getAcknowledgedEtag(dbStats *dbStats, subscription []byte) (float64, bool) {
+	databaseID, err := jp.GetString(dbStats.databaseStats, "DatabaseId")
+	if err != nil {
+		return 0, false
+	}
+	changeVector, _ := jp.GetString(subscription, "ChangeVectorForNextBatchStartingPoint")
+
+	// etags start at 1, so 0 means the change vector is empty or has no valid entry of this
+	// database, e.g. the subscription has not acknowledged any batch yet
+	etag := changeVectorEtag(changeVector, databaseID)
+	if etag == 0 {
+		return 0, false
+	}
+	return float64(etag), true
+}
+
+func getSubscriptionValues(dbStats *dbStats, valueFunc func(name string, subscription []byte) (float64, bool)) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(dbStats.subscriptions, func(subscription []byte, dataType jp.ValueType, offset int, err error) {
+		name, _ := jp.GetString(subscription, "SubscriptionName")
+		if value, ok := valueFunc(name, subscription); ok {
+			labels := generateDatabaseLabels(dbStats, map[string]string{"subscription": name})
+			mi = appendMetricInfo(mi, value, labels)
+		}
+	}, "Results")
+
+	return mi
+}
+
+// getSubscriptionBatchValues reads the most recently started batch of every subscription from its performance history
+func getSubscriptionBatchValues(dbStats *dbStats, valueFunc func(batch []byte) float64) []metricInfo {
+	var mi []metricInfo
+
+	jp.ArrayEach(dbStats.subscriptionPerformance, func(subscription []byte, dataType jp.ValueType, offset int, err error) {
+		name, err := jp.GetString(subscription, "TaskName")
+		if err != nil {
+			name, _ = jp.GetString(subscription, "SubscriptionName")
+		}
+
+		var lastBatch []byte
+		var lastStarted time.Time
+		jp.ArrayEach(subscription, func(batch []byte, dataType jp.ValueType, offset int, err error) {
+			started, _ := jp.GetString(batch, "Started")
+			if t, ok := parseTime(started); ok && !t.Before(lastStarted) {
+				lastBatch, lastStarted = batch, t
+			}
+		}, "BatchPerformance")
+
+		if lastBatch != nil {
+			labels := generateDatabaseLabels(dbStats, map[string]string{"subscription": name})
+			mi = appendMetricInfo(mi, valueFunc(lastBatch), labels)
+		}
+	}, "Results")
+
+	return mi
+}
+
+var databaseNodeStates = map[string]string{"Members": "Member", "Promotables": "Promotable", "Rehabs": "Rehab"}
+
+func getDatabaseNodeState(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	nodeStates := make(map[string]string)
+	forEachDatabaseNode(dbStats, func(nodeTag string, state string) {
+		nodeStates[nodeTag] = state
+	})
+
+	for nodeTag, current := range nodeStates {
+		for _, state := range []string{"Member", "Promotable", "Rehab"} {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			labels := generateDatabaseLabels(dbStats, map[string]string{"member_node_tag": nodeTag, "state": state})
+			mi = appendMetricInfo(mi, value, labels)
+		}
+	}
+
+	return mi
+}
+
+func getDatabaseNodeHealthy(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	forEachDatabaseNode(dbStats, func(nodeTag string, state string) {
+		labels := generateDatabaseLabels(dbStats, map[string]string{"member_node_tag": nodeTag})
+		mi = appendMetricInfo(mi, boolToFloat(isDatabaseNodeHealthy(dbStats, nodeTag)), labels)
+	})
+
+	return mi
+}
+
+func getDatabaseReplicationFactor(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	value, err := jp.GetFloat(dbStats.record, "ReplicationFactor")
+	if err != nil {
+		return mi
+	}
+	mi = appendMetricInfo(mi, value, generateDatabaseLabels(dbStats, nil))
+
+	return mi
+}
+
+func getDatabaseHealthyMembers(dbStats *dbStats) []metricInfo {
+	var mi []metricInfo
+
+	if _, _, _, err := jp.Get(dbStats.record, "NodesTopology", "Members"); err != nil {
+		return mi
+	}
+
+	count := 0
+	forEachDatabaseNode(dbStats, func(nodeTag string, state string) {
+		if state == "Member" && isDatabaseNodeHealthy(dbStats, nodeTag) {
+			count++
+		}
+	})
+	mi = appendMetricInfo(mi, float64(count), generateDatabaseLabels(dbStats, nil))
+
+	return mi
+}
+
+func getDatabaseDisabled(dbStats *dbStats) []metricInfo {
+	return getDatabaseRecordFlag(dbStats, "Disabled")
+}
+
+func getDatabaseEncrypted(dbStats *dbStats) []metricInfo {
+	return getDatabaseRecordFlag(dbStats, "IsEncrypted")
+}
+
+func getDatabaseSharded(dbStats *dbStats) []metricInfo {
+	return getDatabaseRecordFlag(dbStats, "IsSharded")
+}
+
+// getDatabaseRecordFlag reads a boolean of the database record, a missing one is false as older
+// versions, e.g. without sharding, do not report it
+func getDatabaseRecordFlag(dbStats *dbStats, key string) []metricInfo {
+	var mi []metricInfo
+
+	if dbStats.record == nil {
+		return mi
+	}
+	value, _ := jp.GetBoolean(dbStats.record, key)
+	mi = appendMetricInfo(mi, boolToFloat(value), generateDatabaseLabels(dbStats, nil))
+
+	return mi
+}
+
+// forEachDatabaseNode iterates the nodes of the database group, which are listed either as node
+// tags or as objects with a NodeTag
+func forEachDatabaseNode(dbStats *dbStats, nodeFunc func(nodeTag string, state string)) {
+	for _, section := range []string{"Members", "Promotables", "Rehabs"} {
+		jp.ArrayEach(dbStats.record, func(node []byte, dataType jp.ValueType, offset int, err error) {
+			nodeTag := string(node)
+			if dataType == jp.Object {
+				nodeTag, _ = jp.GetString(node, "NodeTag")
+			}
+			nodeFunc(nodeTag, databaseNodeStates[section])
+		}, "NodesTopology", section)
+	}
+}
+
+func isDatabaseNodeHealthy(dbStats *dbStats, nodeTag string) bool {
+	status, _ := jp.GetString(dbStats.record, "NodesTopology", "Status", nodeTag, "LastStatus")
+	return status == "Ok"
+}
+
+func createGauge(name string, help string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	})
+}
+
+func createGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, labels)
+}
+
+func createCounterVec(name string, help string, labels ...string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, labels)
+}
+
+func createDesc(name string, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, labels, nil)
+}
+
+func createExporterGauge(name string, help string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      name,
+		Help:      help,
+	})
+}
+
+func createExporterGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      name,
+		Help:      help,
+	}, labels)
 }
 
 func createDatabaseGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
@@ -385,6 +2315,24 @@ func createDatabaseGaugeVec(name string, help string, labels ...string) *prometh
 	}, append([]string{"database"}, labels...))
 }
 
+func createIndexGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	return createDatabaseGaugeVec(name, help, append([]string{"index", "type", "lock_mode"}, labels...)...)
+}
+
+func createStorageGaugeVec(name string, help string) *prometheus.GaugeVec {
+	return createDatabaseGaugeVec(name, help, "environment", "type")
+}
+
+var etlLabels = []string{"task", "etl_type", "transformation"}
+
+func createReplicationGaugeVec(name string, help string) *prometheus.GaugeVec {
+	return createDatabaseGaugeVec(name, help, "destination", "destination_database", "type", "task")
+}
+
+func createBackupGaugeVec(name string, help string, labels ...string) *prometheus.GaugeVec {
+	return createDatabaseGaugeVec(name, help, append([]string{"task", "backup_type"}, labels...)...)
+}
+
 func createCounter(name string, help string) prometheus.Counter {
 	return prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: namespace,
@@ -434,10 +2382,94 @@ func timeSpanToSeconds(timespanString string) float64 {
 	return result
 }
 
+var sizeRegex = regexp.MustCompile(`^\s*(?P<value>[0-9.]+)\s*(?P<unit>[KMGTP]?)Bytes\s*$`)
+
+var sizeUnits = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+// parseSize converts a humane size like "1.5 GBytes" to bytes
+func parseSize(sizeString string) (float64, bool) {
+	matches := matchNamedGroups(sizeRegex, sizeString)
+	value, err := strconv.ParseFloat(matches["value"], 64)
+	if err != nil {
+		return 0, false
+	}
+	return value * sizeUnits[matches["unit"]], true
+}
+
+var now = time.Now
+
+// ageInSeconds returns time elapsed since a RavenDB timestamp, ok is false if the timestamp is missing
+func ageInSeconds(timestamp string) (float64, bool) {
+	t, ok := parseTime(timestamp)
+	if !ok {
+		return 0, false
+	}
+	return now().Sub(t).Seconds(), true
+}
+
+// timestampInSeconds returns the Unix time of the timestamp, or 0 if it is missing
+func timestampInSeconds(timestamp string) float64 {
+	t, ok := parseTime(timestamp)
+	if !ok {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
+// ticksToTime converts .NET ticks (100ns intervals since year 1) to time
+func ticksToTime(ticks int64) time.Time {
+	const unixEpochTicks = 621355968000000000
+	return time.Unix(0, 0).UTC().Add(time.Duration(ticks-unixEpochTicks) * 100)
+}
+
+// changeVectorEtag returns the etag of the given database in a change vector like
+// "A:1234-dbId1, B:56-dbId2", or 0 if the database is not part of it
+func changeVectorEtag(changeVector string, databaseID string) int64 {
+	for _, entry := range strings.Split(changeVector, ",") {
+		entry = strings.TrimSpace(entry)
+		separator := strings.Index(entry, "-")
+		if separator < 0 || entry[separator+1:] != databaseID {
+			continue
+		}
+		colon := strings.Index(entry, ":")
+		if colon < 0 || colon > separator {
+			continue
+		}
+		if etag, err := strconv.ParseInt(entry[colon+1:separator], 10, 64); err == nil {
+			return etag
+		}
+	}
+	return 0
+}
+
+func parseTime(timestamp string) (time.Time, bool) {
+	if timestamp == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		return t, true
+	}
+	// RavenDB sometimes serializes UTC timestamps without the zone designator
+	if t, err := time.Parse("2006-01-02T15:04:05.9999999", timestamp); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
 func matchNamedGroups(regex *regexp.Regexp, text string) map[string]string {
 	matches := regex.FindStringSubmatch(text)
 
 	results := make(map[string]string)
+	if matches == nil {
+		return results
+	}
 	for i, name := range regex.SubexpNames() {
 		if name != "" {
 			results[name] = matches[i]
@@ -458,9 +2490,88 @@ func generateDatabaseLabels(dbStats *dbStats, additionalLabels map[string]string
 	return labels
 }
 
+func generateIndexLabels(dbStats *dbStats, index []byte, additionalLabels map[string]string) prometheus.Labels {
+	name, _ := jp.GetString(index, "Name")
+	indexType, _ := jp.GetString(index, "Type")
+	lockMode, _ := jp.GetString(index, "LockMode")
+
+	labels := generateDatabaseLabels(dbStats, map[string]string{
+		"index":     name,
+		"type":      indexType,
+		"lock_mode": lockMode,
+	})
+
+	for key, value := range additionalLabels {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+func generateBackupLabels(dbStats *dbStats, task []byte, additionalLabels map[string]string) prometheus.Labels {
+	taskName, _ := jp.GetString(task, "TaskName")
+	backupType, _ := jp.GetString(task, "BackupType")
+
+	labels := generateDatabaseLabels(dbStats, map[string]string{
+		"task":        taskName,
+		"backup_type": backupType,
+	})
+
+	for key, value := range additionalLabels {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// generateReplicationLabels describes the destination of outgoing replication. Internal replication
+// goes to other nodes of the cluster, external and pull replication are named ongoing tasks.
+func generateReplicationLabels(dbStats *dbStats, node []byte) prometheus.Labels {
+	destination, _ := jp.GetString(node, "Url")
+	destinationDatabase, _ := jp.GetString(node, "Database")
+	task, _ := jp.GetString(node, "Name")
+
+	replicationType := "Internal"
+	if _, _, _, err := jp.Get(node, "HubName"); err == nil {
+		replicationType = "PullReplication"
+	} else if _, _, _, err := jp.Get(node, "ConnectionStringName"); err == nil {
+		replicationType = "External"
+	}
+
+	return generateDatabaseLabels(dbStats, map[string]string{
+		"destination":          destination,
+		"destination_database": destinationDatabase,
+		"type":                 replicationType,
+		"task":                 task,
+	})
+}
+
+// generateEtlLabels uses the broker type, e.g. Kafka or RabbitMQ, as the ETL type of queue ETL tasks
+func generateEtlLabels(dbStats *dbStats, task []byte, process []byte) prometheus.Labels {
+	taskName, _ := jp.GetString(task, "TaskName")
+	etlType, _ := jp.GetString(task, "EtlType")
+	if brokerType, err := jp.GetString(task, "QueueBrokerType"); err == nil && brokerType != "" && brokerType != "None" {
+		etlType = brokerType
+	}
+	transformation, _ := jp.GetString(process, "TransformationName")
+
+	return generateDatabaseLabels(dbStats, map[string]string{
+		"task":           taskName,
+		"etl_type":       etlType,
+		"transformation": transformation,
+	})
+}
+
 func appendMetricInfo(tasks []metricInfo, value float64, labels prometheus.Labels) []metricInfo {
 	return append(tasks, metricInfo{
 		Value:  value,
 		Labels: labels,
 	})
 }
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
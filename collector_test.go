@@ -1,6 +1,16 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
 
 func TestParseTimeSpan(t *testing.T) {
 
@@ -18,3 +28,838 @@ func TestParseTimeSpan(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCollectionValues(t *testing.T) {
+
+	dbs := &dbStats{
+		database:        "Demo",
+		collectionStats: []byte(`{"CountOfDocuments": 839, "Collections": {"Orders": 830, "Employees": 9}}`),
+		collectionSizes: []byte(`{
+			"CountOfDocuments": 839,
+			"Collections": {
+				"Orders": {"Name": "Orders", "CountOfDocuments": 830, "Size": {"SizeInBytes": 1048576}, "TombstonesSize": {"SizeInBytes": 4096}},
+				"Employees": {"Name": "Employees", "CountOfDocuments": 9, "Size": {"SizeInBytes": 65536}, "TombstonesSize": {"SizeInBytes": 0}}
+			}
+		}`),
+	}
+
+	expected := map[string]float64{"Orders": 830, "Employees": 9}
+	actual := getCollectionDocuments(dbs)
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d collections but got %d", len(expected), len(actual))
+	}
+	for _, mi := range actual {
+		collection := mi.Labels["collection"]
+		if mi.Labels["database"] != "Demo" || mi.Value != expected[collection] {
+			t.Errorf("Collection %s should have %f documents in database Demo but got %f in %s", collection, expected[collection], mi.Value, mi.Labels["database"])
+		}
+	}
+
+	expected = map[string]float64{"Orders": 4096, "Employees": 0}
+	for _, mi := range getCollectionTombstonesSize(dbs) {
+		collection := mi.Labels["collection"]
+		if mi.Value != expected[collection] {
+			t.Errorf("Collection %s should have tombstones size %f but got %f", collection, expected[collection], mi.Value)
+		}
+	}
+}
+
+func TestGetIndexState(t *testing.T) {
+
+	dbs := &dbStats{
+		database: "Demo",
+		indexes: []byte(`{"Results": [
+			{"Name": "Orders/Totals", "Type": "Map", "LockMode": "Unlock", "State": "Error", "Priority": "Normal", "IsStale": true}
+		]}`),
+	}
+
+	actual := getIndexState(dbs)
+	if len(actual) != len(indexStates) {
+		t.Fatalf("Expected %d state series but got %d", len(indexStates), len(actual))
+	}
+	for _, mi := range actual {
+		expected := 0.0
+		if mi.Labels["state"] == "Error" {
+			expected = 1
+		}
+		if mi.Value != expected {
+			t.Errorf("State %s should be %f but was %f", mi.Labels["state"], expected, mi.Value)
+		}
+		if mi.Labels["index"] != "Orders/Totals" || mi.Labels["type"] != "Map" || mi.Labels["lock_mode"] != "Unlock" {
+			t.Errorf("Unexpected labels %v", mi.Labels)
+		}
+	}
+}
+
+func TestAgeInSeconds(t *testing.T) {
+	now = func() time.Time { return time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	testCases := make(map[string]float64)
+	testCases["2023-03-01T11:59:00.0000000Z"] = 60
+	testCases["2023-03-01T11:00:00.5000000"] = 60*60 - 0.5
+
+	for testCase, expected := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			actual, ok := ageInSeconds(testCase)
+			if !ok || actual != expected {
+				t.Errorf("Timestamp %s should be %fs old but was %fs", testCase, expected, actual)
+			}
+		})
+	}
+
+	if _, ok := ageInSeconds(""); ok {
+		t.Error("Missing timestamp should not have an age")
+	}
+}
+
+func TestGetIndexLastIndexingAgeSkipsIndexesThatNeverIndexed(t *testing.T) {
+	now = func() time.Time { return time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	dbs := &dbStats{
+		database: "Demo",
+		indexes: []byte(`{"Results": [
+			{"Name": "Orders/Totals", "Type": "Map", "LockMode": "Unlock", "LastIndexingTime": "2023-03-01T11:59:00.0000000Z"},
+			{"Name": "Orders/New", "Type": "Map", "LockMode": "Unlock", "LastIndexingTime": null}
+		]}`),
+	}
+
+	actual := getIndexLastIndexingAge(dbs)
+	if len(actual) != 1 || actual[0].Labels["index"] != "Orders/Totals" || actual[0].Value != 60 {
+		t.Errorf("Expected only Orders/Totals indexed 60s ago but got %v", actual)
+	}
+}
+
+func TestGetStorageValues(t *testing.T) {
+
+	report, err := ioutil.ReadFile("testdata/storage_report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs := &dbStats{database: "Demo", storage: report}
+
+	type key struct {
+		metric, environment string
+	}
+
+	expected := map[key]float64{
+		{"allocated", "Documents"}:     134217728,
+		{"used", "Documents"}:          102678528,
+		{"free", "Documents"}:          31539200,
+		{"journals", "Documents"}:      4194304 + 8388608,
+		{"scratch", "Documents"}:       65536 + 131072,
+		{"allocated", "Configuration"}: 262144,
+		{"journals", "Configuration"}:  262144,
+		{"scratch", "Configuration"}:   65536,
+		{"used", "Orders/Totals"}:      4194304,
+		{"journals", "Orders/Totals"}:  0,
+	}
+
+	getters := map[string]func(*dbStats) []metricInfo{
+		"allocated": getStorageAllocated,
+		"used":      getStorageUsed,
+		"free":      getStorageFree,
+		"journals":  getStorageJournals,
+		"scratch":   getStorageScratchBuffers,
+	}
+
+	environmentTypes := map[string]string{
+		"Documents":     "Documents",
+		"Configuration": "Configuration",
+		"Orders/Totals": "Index",
+	}
+
+	for metric, getter := range getters {
+		actual := getter(dbs)
+		if len(actual) != len(environmentTypes) {
+			t.Fatalf("Expected %d %s series but got %d", len(environmentTypes), metric, len(actual))
+		}
+
+		for _, mi := range actual {
+			environment := mi.Labels["environment"]
+			if mi.Labels["type"] != environmentTypes[environment] {
+				t.Errorf("Environment %s should have type %s but had %s", environment, environmentTypes[environment], mi.Labels["type"])
+			}
+			if value, ok := expected[key{metric, environment}]; ok && mi.Value != value {
+				t.Errorf("Metric %s of environment %s should be %f but was %f", metric, environment, value, mi.Value)
+			}
+		}
+	}
+}
+
+func TestOrganizeGetResultsWithFailedEndpoint(t *testing.T) {
+
+	failed := request{endpoint: databaseStatsEndpoint, database: "Broken"}
+	succeeded := request{endpoint: databaseStatsEndpoint, database: "Demo"}
+
+	results := map[request]getResult{
+		failed:    {request: failed, err: errors.New("Server responded with HTTP 500")},
+		succeeded: {request: succeeded, result: []byte(`{"CountOfDocuments": 1063}`)},
+	}
+
+	stats := organizeGetResults(results, []string{"Broken", "Demo"})
+
+	if len(stats.endpoints) != 2 {
+		t.Errorf("Expected 2 endpoint results but got %d", len(stats.endpoints))
+	}
+
+	for _, dbs := range stats.dbStats {
+		documents := getDatabaseDocuments(dbs)
+		switch dbs.database {
+		case "Broken":
+			if len(documents) != 0 {
+				t.Errorf("Expected no document count for failed database but got %v", documents)
+			}
+		case "Demo":
+			if len(documents) != 1 || documents[0].Value != 1063 {
+				t.Errorf("Expected document count 1063 for database Demo but got %v", documents)
+			}
+		}
+	}
+}
+
+func TestGetBackupValues(t *testing.T) {
+
+	tasks := []byte(`{"OngoingTasks": [
+		{"TaskId": 12, "TaskName": "Nightly", "TaskType": "Backup", "BackupType": "Backup",
+			"BackupDestinations": ["Local", "S3"],
+			"LastFullBackup": "2023-03-01T02:00:00.0000000Z",
+			"NextBackup": {"DateTime": "2023-03-02T02:00:00.0000000Z", "IsFull": true}},
+		{"TaskId": 13, "TaskName": "Replica", "TaskType": "Replication"}
+	]}`)
+
+	results := map[request]getResult{
+		{endpoint: tasksEndpoint, database: "Demo"}: {result: tasks},
+	}
+	requests := prepareBackupStatusRequests(results, []string{"Demo"})
+	if len(requests) != 1 || requests[0].path() != "/databases/Demo/periodic-backup/status?taskId=12" {
+		t.Fatalf("Expected a single backup status request for task 12 but got %v", requests)
+	}
+
+	dbs := &dbStats{
+		database: "Demo",
+		tasks:    tasks,
+		backupStatuses: map[string][]byte{
+			"12": []byte(`{"Status": {"TaskId": 12, "DurationInMs": 1500,
+				"LastFullBackup": "2023-03-01T02:00:00.0000000Z",
+				"Error": {"Exception": "Disk full", "At": "2023-03-01T14:00:00.0000000Z"}}}`),
+		},
+	}
+
+	testCases := map[string]struct {
+		getter   func(*dbStats) []metricInfo
+		expected float64
+	}{
+		"last full":        {getBackupLastFull, 1677636000},
+		"last incremental": {getBackupLastIncremental, 0},
+		"next":             {getBackupNext, 1677722400},
+		"duration":         {getBackupLastDuration, 1.5},
+		"failed":           {getBackupLastFailed, 1},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual := testCase.getter(dbs)
+			if len(actual) != 1 {
+				t.Fatalf("Expected a single value but got %d", len(actual))
+			}
+			if actual[0].Value != testCase.expected {
+				t.Errorf("Expected %f but got %f", testCase.expected, actual[0].Value)
+			}
+			if actual[0].Labels["task"] != "Nightly" || actual[0].Labels["backup_type"] != "Backup" {
+				t.Errorf("Unexpected labels %v", actual[0].Labels)
+			}
+		})
+	}
+
+	if destinations := getBackupDestination(dbs); len(destinations) != 2 {
+		t.Errorf("Expected 2 backup destinations but got %d", len(destinations))
+	}
+}
+
+func TestChangeVectorEtag(t *testing.T) {
+
+	testCases := map[string]int64{
+		"A:1234-dbA, B:56-dbB": 1234,
+		"B:56-dbB, A:78-dbA":   78,
+		"B:56-dbB":             0,
+		"":                     0,
+	}
+
+	for changeVector, expected := range testCases {
+		t.Run(changeVector, func(t *testing.T) {
+			if actual := changeVectorEtag(changeVector, "dbA"); actual != expected {
+				t.Errorf("Expected etag %d but got %d", expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetReplicationValues(t *testing.T) {
+	now = func() time.Time { return time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	dbs := &dbStats{
+		database:      "Demo",
+		databaseStats: []byte(`{"DatabaseId": "dbA", "LastDocEtag": 1500}`),
+		replicationOutgoing: []byte(`{"Stats": [
+			{"Destination": {"Url": "https://b.example.com", "Database": "Demo", "NodeTag": "B"},
+				"LastAcceptedChangeVector": "A:1200-dbA, B:30-dbB", "LastSentEtag": 1400,
+				"LastHeartbeatTicks": 638132687400000000},
+			{"Destination": {"Url": "https://dr.example.com", "Database": "Demo-DR", "Name": "To DR", "ConnectionStringName": "DR"},
+				"LastAcceptedChangeVector": "A:1500-dbA", "LastSentEtag": 1500}
+		]}`),
+		replicationFailures: []byte(`{"Stats": [
+			{"Key": {"Url": "https://c.example.com", "Database": "Demo", "NodeTag": "C"}, "Value": {"RetriesCount": 3}}
+		]}`),
+		replicationIncoming: []byte(`{"Stats": [
+			{"Key": {"SourceUrl": "https://b.example.com", "SourceDatabaseName": "Demo"}, "Value": "2023-03-01T11:59:30.0000000Z"}
+		]}`),
+	}
+
+	lag := map[string]float64{}
+	for _, mi := range getReplicationEtagLag(dbs) {
+		lag[mi.Labels["type"]] = mi.Value
+	}
+	if lag["Internal"] != 300 || lag["External"] != 0 {
+		t.Errorf("Expected lag of 300 for internal and 0 for external replication but got %v", lag)
+	}
+
+	heartbeat := getReplicationLastHeartbeatAge(dbs)
+	if len(heartbeat) != 1 || heartbeat[0].Value != 60 {
+		t.Errorf("Expected heartbeat age of 60s for a single destination but got %v", heartbeat)
+	}
+
+	failing := map[string]float64{}
+	for _, mi := range getReplicationFailing(dbs) {
+		failing[mi.Labels["destination"]] = mi.Value
+	}
+	expected := map[string]float64{"https://b.example.com": 0, "https://dr.example.com": 0, "https://c.example.com": 1}
+	if !reflect.DeepEqual(failing, expected) {
+		t.Errorf("Expected failing destinations %v but got %v", expected, failing)
+	}
+
+	incoming := getReplicationIncomingLastActivityAge(dbs)
+	if len(incoming) != 1 || incoming[0].Value != 30 || incoming[0].Labels["source_database"] != "Demo" {
+		t.Errorf("Unexpected incoming replication activity %v", incoming)
+	}
+}
+
+func TestGetEtlValues(t *testing.T) {
+
+	dbs := &dbStats{
+		database: "Demo",
+		etlStats: []byte(`{"Results": [
+			{"TaskId": 5, "TaskName": "Orders to SQL", "EtlType": "Sql", "Stats": [
+				{"TransformationName": "Orders", "Statistics": {"LastProcessedEtag": 830, "LoadSuccesses": 120, "LoadErrors": 2, "TransformationErrors": 0, "WasLatestLoadSuccessful": false, "FallbackTime": "00:00:30"}}
+			]},
+			{"TaskId": 6, "TaskName": "Events", "EtlType": "Queue", "QueueBrokerType": "Kafka", "Stats": [
+				{"TransformationName": "Employees", "Statistics": {"LastProcessedEtag": 12, "LoadSuccesses": 4, "LoadErrors": 1, "TransformationErrors": 0, "WasLatestLoadSuccessful": false, "FallbackTime": null}}
+			]}
+		]}`),
+		etlProgress: []byte(`{"Results": [
+			{"TaskName": "Orders to SQL", "EtlType": "Sql", "ProcessesProgress": [
+				{"TransformationName": "Orders", "TotalNumberOfDocuments": 1000, "NumberOfDocumentsToProcess": 170, "TotalNumberOfDocumentTombstones": 10, "NumberOfDocumentTombstonesToProcess": 3}
+			]}
+		]}`),
+	}
+
+	fallback := map[string]float64{}
+	for _, mi := range getEtlFallback(dbs) {
+		fallback[mi.Labels["etl_type"]+"/"+mi.Labels["transformation"]] = mi.Value
+	}
+	expected := map[string]float64{"Sql/Orders": 1, "Kafka/Employees": 0}
+	if !reflect.DeepEqual(fallback, expected) {
+		t.Errorf("Expected fallback %v but got %v", expected, fallback)
+	}
+
+	lastLoad := getEtlLastLoadSuccessful(dbs)
+	if len(lastLoad) != 2 || lastLoad[0].Value != 0 || lastLoad[1].Value != 0 {
+		t.Errorf("Unexpected last load success %v", lastLoad)
+	}
+
+	extracted := map[string]float64{}
+	for _, mi := range getEtlItemsExtracted(dbs) {
+		extracted[mi.Labels["transformation"]+"/"+mi.Labels["item_type"]] = mi.Value
+	}
+	expected = map[string]float64{"Orders/documents": 830, "Orders/document_tombstones": 7}
+	if !reflect.DeepEqual(extracted, expected) {
+		t.Errorf("Expected extracted items %v but got %v", expected, extracted)
+	}
+
+	loadErrors := getEtlLoadErrors(dbs)
+	if len(loadErrors) != 2 || loadErrors[0].Value != 2 || loadErrors[0].Labels["task"] != "Orders to SQL" {
+		t.Errorf("Unexpected load errors %v", loadErrors)
+	}
+}
+
+func TestGetSubscriptionValues(t *testing.T) {
+	now = func() time.Time { return time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	dbs := &dbStats{
+		database:      "Demo",
+		databaseStats: []byte(`{"DatabaseId": "dbA", "LastDocEtag": 1500}`),
+		subscriptions: []byte(`{"Results": [
+			{"SubscriptionName": "Orders", "ChangeVectorForNextBatchStartingPoint": "A:1450-dbA, B:20-dbB",
+				"LastBatchAckTime": "2023-03-01T11:58:00.0000000Z", "LastClientConnectionTime": "2023-03-01T10:00:00.0000000Z"},
+			{"SubscriptionName": "New", "ChangeVectorForNextBatchStartingPoint": null},
+			{"SubscriptionName": "Empty", "ChangeVectorForNextBatchStartingPoint": ""},
+			{"SubscriptionName": "Invalid", "ChangeVectorForNextBatchStartingPoint": "A:abc-dbA"},
+			{"SubscriptionName": "Other database", "ChangeVectorForNextBatchStartingPoint": "B:20-dbB"}
+		]}`),
+		subscriptionConnections: map[string][]byte{
+			"Orders": []byte(`{"Results": [{"ClientUri": "10.0.0.1:5000"}, {"ClientUri": "10.0.0.2:5000"}]}`),
+		},
+		subscriptionPerformance: []byte(`{"Results": [
+			{"TaskId": 1, "TaskName": "Orders", "BatchPerformance": [
+				{"BatchId": 2, "Started": "2023-03-01T11:57:00.0000000Z", "DurationInMs": 250, "NumberOfDocuments": 50},
+				{"BatchId": 1, "Started": "2023-03-01T11:50:00.0000000Z", "DurationInMs": 900, "NumberOfDocuments": 256}
+			]}
+		]}`),
+	}
+
+	lag := map[string]float64{}
+	for _, mi := range getSubscriptionEtagLag(dbs) {
+		lag[mi.Labels["subscription"]] = mi.Value
+	}
+	if !reflect.DeepEqual(lag, map[string]float64{"Orders": 50}) {
+		t.Errorf("Expected subscription lag only where the change vector has an etag of this database but got %v", lag)
+	}
+
+	acknowledged := getSubscriptionLastAcknowledgedEtag(dbs)
+	if len(acknowledged) != 1 || acknowledged[0].Value != 1450 {
+		t.Errorf("Expected last acknowledged etag 1450 of a single subscription but got %v", acknowledged)
+	}
+
+	workers := getSubscriptionConnectedWorkers(dbs)
+	if len(workers) != 1 || workers[0].Value != 2 {
+		t.Errorf("Expected 2 workers connected to a single subscription but got %v", workers)
+	}
+
+	activity := getSubscriptionLastClientActivityAge(dbs)
+	if len(activity) != 1 || activity[0].Value != 120 {
+		t.Errorf("Expected last client activity 120s ago but got %v", activity)
+	}
+
+	duration := getSubscriptionLastBatchDuration(dbs)
+	if len(duration) != 1 || duration[0].Value != 0.25 || duration[0].Labels["subscription"] != "Orders" {
+		t.Errorf("Expected last batch duration of 0.25s but got %v", duration)
+	}
+}
+
+func TestGetCertificateExpiry(t *testing.T) {
+
+	_, serverCert := createTestCertificate(t, "a.example.com", nil, nil)
+
+	s := &stats{
+		certificates: []byte(`{"Results": [
+			{"Name": "Admin", "Thumbprint": "ABC123", "SecurityClearance": "Operator", "NotAfter": "2024-03-01T00:00:00.0000000"},
+			{"Name": "Node A", "Thumbprint": "DEF456", "SecurityClearance": "ClusterNode", "NotAfter": "2023-06-01T00:00:00.0000000Z"}
+		]}`),
+		serverCertificate: serverCert,
+	}
+
+	actual := getCertificateExpiry(s)
+	if len(actual) != 3 {
+		t.Fatalf("Expected 3 certificates but got %d", len(actual))
+	}
+
+	expected := []prometheus.Labels{
+		{"thumbprint": "ABC123", "name": "Admin", "clearance": "Operator", "type": "client"},
+		{"thumbprint": "DEF456", "name": "Node A", "clearance": "ClusterNode", "type": "server"},
+	}
+	for i, labels := range expected {
+		if !reflect.DeepEqual(actual[i].Labels, labels) {
+			t.Errorf("Expected labels %v but got %v", labels, actual[i].Labels)
+		}
+	}
+	if actual[0].Value != 1709251200 {
+		t.Errorf("Expected expiry 1709251200 but got %f", actual[0].Value)
+	}
+	if actual[2].Labels["type"] != "server" || actual[2].Value != float64(serverCert.NotAfter.Unix()) {
+		t.Errorf("Expected the presented server certificate but got %v", actual[2])
+	}
+}
+
+func TestGetLicenseValues(t *testing.T) {
+
+	s := &stats{
+		licenseStatus: []byte(`{"Type": "Professional", "Expired": false, "Expiration": "2024-01-31T00:00:00.0000000Z",
+			"MaxCores": 12, "MaxMemory": 48, "MaxClusterSize": 5}`),
+		clusterTopology: []byte(`{"Topology": {"TopologyId": "abc"}, "NodeLicenseDetails": {
+			"A": {"UtilizedCores": 4, "NumberOfCores": 8},
+			"B": {"UtilizedCores": 6, "NumberOfCores": 6}
+		}}`),
+	}
+
+	if info := getLicenseInfo(s); info[0].Labels["type"] != "Professional" {
+		t.Errorf("Expected Professional license but got %v", info[0].Labels)
+	}
+	if expiration, ok := getLicenseExpiration(s); !ok || expiration != 1706659200 {
+		t.Errorf("Expected expiration 1706659200 but got %f", expiration)
+	}
+	if maxMemory := getLicenseMaxMemory(s); maxMemory != 48*1024*1024*1024 {
+		t.Errorf("Expected 48 GB of licensed memory but got %f", maxMemory)
+	}
+	utilized := map[string]float64{}
+	for _, info := range getLicenseUtilizedCores(s) {
+		utilized[info.Labels["member_node_tag"]] = info.Value
+	}
+	if !reflect.DeepEqual(utilized, map[string]float64{"A": 4, "B": 6}) {
+		t.Errorf("Unexpected utilized cores per node %v", utilized)
+	}
+	if utilized := getLicenseClusterUtilizedCores(s); utilized != 10 {
+		t.Errorf("Expected 10 utilized cores in the cluster but got %f", utilized)
+	}
+}
+
+func TestCollectClusterCountsTermChanges(t *testing.T) {
+
+	e := newExporter(nil)
+	s := &stats{
+		clusterTopology: []byte(`{"CurrentTerm": 3, "CurrentState": "Follower", "NodeTag": "B", "Topology": {
+			"Members": {"A": "https://a:443", "B": "https://b:443"}, "Watchers": {"C": "https://c:443"}},
+			"Status": {"A": {"Connected": true}, "C": {"Connected": false}}}`),
+		clusterLog: []byte(`{"CommitIndex": 90, "LastLogEntryIndex": 100, "LastAppliedIndex": 85}`),
+	}
+
+	collectCluster := func() {
+		ch := make(chan prometheus.Metric, 100)
+		e.collectCluster(s, ch)
+		close(ch)
+	}
+
+	collectCluster()
+	s.clusterTopology = []byte(`{"CurrentTerm": 5, "CurrentState": "Leader"}`)
+	collectCluster()
+
+	if changes := readMetric(t, e.clusterTermChanges).GetCounter().GetValue(); changes != 2 {
+		t.Errorf("Expected 2 term changes but got %f", changes)
+	}
+	if lag := readMetric(t, e.clusterCommitLag).GetGauge().GetValue(); lag != 10 {
+		t.Errorf("Expected commit lag 10 but got %f", lag)
+	}
+	if lag := readMetric(t, e.clusterApplyLag).GetGauge().GetValue(); lag != 5 {
+		t.Errorf("Expected apply lag 5 but got %f", lag)
+	}
+}
+
+func TestGetClusterNodeState(t *testing.T) {
+
+	s := &stats{
+		clusterTopology: []byte(`{"CurrentState": "Follower", "NodeTag": "B", "Topology": {
+			"Members": {"A": "https://a:443", "B": "https://b:443"}, "Watchers": {"C": "https://c:443"}},
+			"Status": {"A": {"Connected": true}, "C": {"Connected": false}}}`),
+	}
+
+	states := map[string]string{}
+	for _, info := range getClusterNodeState(s) {
+		if info.Value == 1 {
+			states[info.Labels["member_node_tag"]] = info.Labels["state"]
+		}
+	}
+
+	expected := map[string]string{"A": "Member", "B": "Member", "C": "Watcher"}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected node states %v but got %v", expected, states)
+	}
+
+	connected := map[string]float64{}
+	for _, info := range getClusterNodeConnected(s) {
+		connected[info.Labels["member_node_tag"]] = info.Value
+	}
+	if !reflect.DeepEqual(connected, map[string]float64{"A": 1, "C": 0}) {
+		t.Errorf("Unexpected node connections %v", connected)
+	}
+}
+
+func readMetric(t *testing.T, metric prometheus.Metric) *dto.Metric {
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestGetDatabaseTopologyValues(t *testing.T) {
+
+	dbs := &dbStats{
+		database: "Demo",
+		record: []byte(`{"Name": "Demo", "Disabled": false, "IsEncrypted": true, "ReplicationFactor": 3,
+			"NodesTopology": {
+				"Members": [{"NodeTag": "A", "NodeUrl": "https://a:443"}, {"NodeTag": "B", "NodeUrl": "https://b:443"}],
+				"Promotables": [],
+				"Rehabs": [{"NodeTag": "C", "NodeUrl": "https://c:443"}],
+				"Status": {"A": {"LastStatus": "Ok"}, "B": {"LastStatus": "NotResponding"}, "C": {"LastStatus": "Ok"}}
+			}}`),
+	}
+
+	states := map[string]string{}
+	for _, info := range getDatabaseNodeState(dbs) {
+		if info.Value == 1 {
+			states[info.Labels["member_node_tag"]] = info.Labels["state"]
+		}
+	}
+	expected := map[string]string{"A": "Member", "B": "Member", "C": "Rehab"}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected node states %v but got %v", expected, states)
+	}
+
+	healthy := map[string]float64{}
+	for _, info := range getDatabaseNodeHealthy(dbs) {
+		healthy[info.Labels["member_node_tag"]] = info.Value
+	}
+	if !reflect.DeepEqual(healthy, map[string]float64{"A": 1, "B": 0, "C": 1}) {
+		t.Errorf("Unexpected node health %v", healthy)
+	}
+
+	if healthy := getDatabaseHealthyMembers(dbs); healthy[0].Value != 1 {
+		t.Errorf("Expected 1 healthy member but got %f", healthy[0].Value)
+	}
+	if factor := getDatabaseReplicationFactor(dbs); factor[0].Value != 3 {
+		t.Errorf("Expected replication factor 3 but got %f", factor[0].Value)
+	}
+	if encrypted := getDatabaseEncrypted(dbs); encrypted[0].Value != 1 {
+		t.Errorf("Expected encrypted database but got %f", encrypted[0].Value)
+	}
+	if sharded := getDatabaseSharded(dbs); sharded[0].Value != 0 {
+		t.Errorf("Expected not sharded database but got %f", sharded[0].Value)
+	}
+}
+
+func TestGetMemoryValues(t *testing.T) {
+
+	s := &stats{
+		memory: []byte(`{"WorkingSet": 1073741824, "ManagedAllocations": 268435456, "TotalUnmanagedAllocations": 134217728,
+			"MemoryInformation": {"AvailableMemory": "1.5 GBytes", "IsLowMemory": true},
+			"Threads": [
+				{"Name": "Indexing of Orders/Totals", "Allocations": 1024},
+				{"Name": "Request processing", "Allocations": 2048},
+				{"Name": "Request processing", "HumaneAllocations": "2 KBytes"}
+			]}`),
+	}
+
+	values := map[string]float64{}
+	for _, info := range getMemoryBytes(s) {
+		values[info.Labels["type"]] = info.Value
+	}
+	expected := map[string]float64{
+		"working_set": 1073741824,
+		"managed":     268435456,
+		"unmanaged":   134217728,
+		"available":   1.5 * 1024 * 1024 * 1024,
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected memory %v but got %v", expected, values)
+	}
+
+	if low, ok := getMemoryLow(s); !ok || low != 1 {
+		t.Errorf("Expected low memory but got %f", low)
+	}
+
+	threads := map[string]float64{}
+	for _, info := range getMemoryThreadUnmanagedBytes(s) {
+		threads[info.Labels["thread"]] = info.Value
+	}
+	if threads["Request processing"] != 4096 || threads["Indexing of Orders/Totals"] != 1024 {
+		t.Errorf("Unexpected thread allocations %v", threads)
+	}
+
+	if _, ok := parseSize("unknown"); ok {
+		t.Error("Expected an invalid size not to be parsed")
+	}
+}
+
+func TestGetCPUValues(t *testing.T) {
+
+	s := &stats{
+		cpu: []byte(`{
+			"CpuStats": [
+				{"ProcessName": "Raven.Server", "TotalProcessorTime": "00:01:30.0000000", "UserProcessorTime": "00:01:00.0000000", "PrivilegedProcessorTime": "00:00:30.0000000"},
+				{"ProcessName": "Raven.Debug", "TotalProcessorTime": "00:00:02.0000000", "UserProcessorTime": "00:00:02.0000000", "PrivilegedProcessorTime": "00:00:00.0000000"}
+			],
+			"ThreadPoolStats": [{"AvailableThreadPoolWorkerThreads": 32760, "MinThreadPoolWorkerThreads": 8, "MaxThreadPoolWorkerThreads": 32767,
+				"AvailableThreadPoolCompletionPortThreads": 1000, "MinThreadPoolCompletionPortThreads": 8, "MaxThreadPoolCompletionPortThreads": 1000}]
+		}`),
+		serverMonitoring: []byte(`{"Cpu": {"ProcessUsage": 12, "MachineUsage": 50, "ProcessorCount": 8, "AssignedProcessorCount": 4,
+			"ThreadPoolAvailableWorkerThreads": 100}}`),
+	}
+
+	times := map[string]float64{}
+	for _, info := range getCPUProcessTime(s) {
+		times[info.Labels["process"]+"/"+info.Labels["mode"]] = info.Value
+	}
+	expected := map[string]float64{
+		"Raven.Server/user":       60,
+		"Raven.Server/privileged": 30,
+		"Raven.Debug/user":        2,
+		"Raven.Debug/privileged":  0,
+	}
+	if !reflect.DeepEqual(times, expected) {
+		t.Errorf("Expected CPU times %v but got %v", expected, times)
+	}
+	if cpuTime := getCPUTime(s); cpuTime != 90 {
+		t.Errorf("Expected CPU time of the Raven.Server entry but got %f", cpuTime)
+	}
+
+	usage := map[string]float64{}
+	for _, info := range getCPUUsage(s) {
+		usage[info.Labels["type"]] = info.Value
+	}
+	if !reflect.DeepEqual(usage, map[string]float64{"process": 0.12, "machine": 0.5}) {
+		t.Errorf("Unexpected CPU usage %v", usage)
+	}
+
+	threads := map[string]float64{}
+	for _, info := range getThreadPoolThreads(s) {
+		threads[info.Labels["pool"]+"/"+info.Labels["type"]] = info.Value
+	}
+	if len(threads) != 6 || threads["worker/available"] != 32760 || threads["io/min"] != 8 {
+		t.Errorf("Unexpected thread pool threads %v", threads)
+	}
+
+	s.cpu = nil
+	if threads := getThreadPoolThreads(s); len(threads) != 1 || threads[0].Value != 100 {
+		t.Errorf("Expected available worker threads of the monitoring endpoint but got %v", threads)
+	}
+}
+
+func TestGetCPUTime(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		cpu      string
+		expected float64
+	}{
+		{"server entry last", `{"CpuStats": [
+			{"ProcessName": "Raven.Debug", "TotalProcessorTime": "00:00:02.0000000"},
+			{"ProcessName": "Raven.Server", "TotalProcessorTime": "00:01:30.0000000"}
+		]}`, 90},
+		{"no process names", `{"CpuStats": [{"TotalProcessorTime": "00:00:10.0000000"}, {"TotalProcessorTime": "00:00:02.0000000"}]}`, 10},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if cpuTime := getCPUTime(&stats{cpu: []byte(testCase.cpu)}); cpuTime != testCase.expected {
+				t.Errorf("Expected CPU time %f but got %f", testCase.expected, cpuTime)
+			}
+		})
+	}
+}
+
+func TestGetMeterValues(t *testing.T) {
+
+	s := &stats{
+		metrics: []byte(`{
+			"Requests": {
+				"RequestsPerSec": {"Current": 2, "Count": 1000, "MeanRate": 1.5, "OneMinuteRate": 3, "FiveMinuteRate": 2.5, "FifteenMinuteRate": 2},
+				"ConcurrentRequestsCount": 1,
+				"RequestDuration": {"Count": 10, "Mean": 20, "Percentiles": {"P50": 10, "P99": 150}}
+			},
+			"Docs": {"PutsPerSec": {"Count": 50, "OneMinuteRate": 0.5}},
+			"MapIndexes": {"IndexedPerSec": {"Count": 7, "OneMinuteRate": 0.1}}
+		}`),
+	}
+
+	totals := map[string]float64{}
+	for _, info := range getMeterTotal(s) {
+		totals[info.Labels["section"]+"."+info.Labels["meter"]] = info.Value
+	}
+	expected := map[string]float64{"Requests.RequestsPerSec": 1000, "Docs.PutsPerSec": 50, "MapIndexes.IndexedPerSec": 7}
+	if !reflect.DeepEqual(totals, expected) {
+		t.Errorf("Expected meter totals %v but got %v", expected, totals)
+	}
+
+	if rates := getMeterRate(s); len(rates) != 7 {
+		t.Errorf("Expected 7 meter rates but got %v", rates)
+	}
+	if count := getMeterCount(s.metrics, "MapIndexes", "IndexedPerSec"); count != 7 {
+		t.Errorf("Expected 7 indexed documents but got %f", count)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	collectTimers(s.metrics, createDesc("timer_duration_seconds", "", "section", "timer"), ch)
+	close(ch)
+
+	summary := readMetric(t, <-ch).GetSummary()
+	if summary.GetSampleCount() != 10 || summary.GetSampleSum() != 0.2 || len(summary.Quantile) != 2 {
+		t.Errorf("Unexpected timer summary %v", summary)
+	}
+	if quantile := summary.Quantile[1]; quantile.GetQuantile() != 0.99 || quantile.GetValue() != 0.15 {
+		t.Errorf("Expected 99th percentile of 0.15s but got %v", quantile)
+	}
+}
+
+func TestCollectIndexMeterCounters(t *testing.T) {
+
+	metrics := []byte(`{
+		"MapIndexes": {"IndexedPerSec": {"Count": 10}, "MappedPerSec": {"Count": 1}, "ReducedPerSec": {"Count": 2}},
+		"MapReduceIndexes": {"MappedPerSec": {"Count": 20}, "ReducedPerSec": {"Count": 30}}
+	}`)
+	s := &stats{
+		metrics: metrics,
+		dbStats: []*dbStats{{database: "Demo", metrics: metrics}},
+	}
+
+	e := newExporter(nil)
+	ch := make(chan prometheus.Metric, 100)
+	e.collectServer(s, ch)
+	e.collectDatabases(s, ch)
+	close(ch)
+
+	counters := map[string]struct {
+		metric   prometheus.Metric
+		expected float64
+	}{
+		"ravendb_mapindex_indexed_total":                {e.mapIndexIndexedTotal, 10},
+		"ravendb_database_mapindex_indexed_total":       {e.databaseMapIndexIndexedTotal.WithLabelValues("Demo"), 10},
+		"ravendb_database_mapreduceindex_mapped_total":  {e.databaseMapReduceIndexMappedTotal.WithLabelValues("Demo"), 20},
+		"ravendb_database_mapreduceindex_reduced_total": {e.databaseMapReduceIndexReducedTotal.WithLabelValues("Demo"), 30},
+	}
+	for name, counter := range counters {
+		if actual := readMetric(t, counter.metric).GetCounter().GetValue(); actual != counter.expected {
+			t.Errorf("Expected %s to be %f but got %f", name, counter.expected, actual)
+		}
+	}
+}
+
+func TestDescribeDatabaseDocumentPutBytes(t *testing.T) {
+
+	e := newExporter(nil)
+	ch := make(chan *prometheus.Desc, 500)
+	e.Describe(ch)
+	close(ch)
+
+	for desc := range ch {
+		if strings.Contains(desc.String(), `"ravendb_database_document_put_bytes_total"`) {
+			return
+		}
+	}
+	t.Error("Expected ravendb_database_document_put_bytes_total to be described")
+}
+
+func TestProbeExporterOmitsTermChanges(t *testing.T) {
+
+	e := newProbeExporter(nil)
+
+	descs := make(chan *prometheus.Desc, 500)
+	e.Describe(descs)
+	close(descs)
+	for desc := range descs {
+		if strings.Contains(desc.String(), `"ravendb_cluster_term_changes_total"`) {
+			t.Error("Expected ravendb_cluster_term_changes_total not to be described by probes")
+		}
+	}
+
+	s := &stats{clusterTopology: []byte(`{"CurrentTerm": 5, "CurrentState": "Leader"}`)}
+	metrics := make(chan prometheus.Metric, 100)
+	e.collectCluster(s, metrics)
+	close(metrics)
+	for metric := range metrics {
+		if strings.Contains(metric.Desc().String(), `"ravendb_cluster_term_changes_total"`) {
+			t.Error("Expected ravendb_cluster_term_changes_total not to be collected by probes")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+const (
+	serverCollector         = "server"
+	databaseCollector       = "database"
+	indexCollector          = "index"
+	collectionCollector     = "collection"
+	collectionSizeCollector = "collection-size"
+	tasksCollector          = "tasks"
+	storageCollector        = "storage"
+	backupCollector         = "backup"
+	replicationCollector    = "replication"
+	etlCollector            = "etl"
+	subscriptionCollector   = "subscription"
+	certificateCollector    = "certificate"
+	licenseCollector        = "license"
+	clusterCollector        = "cluster"
+	topologyCollector       = "topology"
+	memoryCollector         = "memory"
+	cpuCollector            = "cpu"
+	meterCollector          = "meter"
+)
+
+const backupTaskType = "Backup"
+
+// collectorNames lists groups of metrics that can be switched on and off. A disabled collector
+// does not emit its metrics and skips the RavenDB endpoints it needs.
+var collectorNames = []string{
+	serverCollector,
+	databaseCollector,
+	indexCollector,
+	collectionCollector,
+	collectionSizeCollector,
+	tasksCollector,
+	storageCollector,
+	backupCollector,
+	replicationCollector,
+	etlCollector,
+	subscriptionCollector,
+	certificateCollector,
+	licenseCollector,
+	clusterCollector,
+	topologyCollector,
+	memoryCollector,
+	cpuCollector,
+	meterCollector,
+}
+
+// collectorsDisabledByDefault are too expensive to call on every scrape unless asked for
+var collectorsDisabledByDefault = map[string]bool{
+	collectionSizeCollector: true,
+}
+
+// collectorToggles is filled from --collector-<name> flags, missing entries use the default
+var collectorToggles = make(map[string]*bool)
+
+func collectorEnabled(name string) bool {
+	if enabled, ok := collectorToggles[name]; ok {
+		return *enabled
+	}
+	return !collectorsDisabledByDefault[name]
+}
+
+func enabledCollectors() []string {
+	var enabled []string
+	for _, name := range collectorNames {
+		if collectorEnabled(name) {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestDisabledCollectorSkipsEndpoints(t *testing.T) {
+
+	disabled := false
+	collectorToggles[storageCollector] = &disabled
+	defer delete(collectorToggles, storageCollector)
+
+	for _, request := range prepareRequests([]string{"Demo"}) {
+		if request.endpoint == storageReportEndpoint {
+			t.Errorf("Storage report should not be requested when the storage collector is disabled")
+		}
+	}
+}
+
+func TestCollectionSizesAreDisabledByDefault(t *testing.T) {
+
+	endpoints := map[string]bool{}
+	for _, request := range prepareRequests([]string{"Demo"}) {
+		endpoints[request.endpoint] = true
+	}
+
+	if !endpoints[collectionStatsEndpoint] {
+		t.Errorf("Collection stats should be requested by default")
+	}
+	if endpoints[collectionSizesEndpoint] {
+		t.Errorf("Detailed collection stats should only be requested when the collection-size collector is enabled")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/namsral/flag"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile  string
+	checkConfig bool
+
+	probeTargets      = map[string]*target{}
+	configTLSProfiles = map[string]*tlsProfile{}
+)
+
+// config is the structure of the YAML file given with --config-file. Flags and env
+// variables which are explicitly set take precedence over the values in the file.
+type config struct {
+	RavenDbURL         string `yaml:"ravendb_url"`
+	Port               uint   `yaml:"port"`
+	Timeout            string `yaml:"timeout"`
+	CollectionInterval string `yaml:"collection_interval"`
+	Verbose            bool   `yaml:"verbose"`
+	DiscoverCluster    bool   `yaml:"discover_cluster"`
+	TLSReloadInterval  string `yaml:"tls_reload_interval"`
+	WebConfigFile      string `yaml:"web_config_file"`
+
+	TLS         *tlsProfile            `yaml:"tls"`
+	TLSProfiles map[string]*tlsProfile `yaml:"tls_profiles"`
+	Targets     []*target              `yaml:"targets"`
+
+	Databases struct {
+		Include []string `yaml:"include"`
+		Exclude []string `yaml:"exclude"`
+	} `yaml:"databases"`
+
+	Collectors    map[string]bool `yaml:"collectors"`
+	LabelRewrites []*labelRewrite `yaml:"label_rewrites"`
+}
+
+// target is a named RavenDB server which can be scraped with /probe?target=<name>
+type target struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url"`
+	TLSProfile string `yaml:"tls_profile"`
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyConfig copies the settings from the config file to the flags, unless a flag
+// was explicitly set on the commandline or with an env variable
+func applyConfig(cfg *config) error {
+	explicit := explicitFlags(flag.CommandLine)
+
+	for name := range cfg.Collectors {
+		if _, ok := collectorToggles[name]; !ok {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+
+	if err := setFlags(flag.CommandLine, cfg.flagValues(), explicit); err != nil {
+		return err
+	}
+
+	if !explicit["database-include"] && len(cfg.Databases.Include) > 0 {
+		databaseIncludePatterns = cfg.Databases.Include
+	}
+	if !explicit["database-exclude"] && len(cfg.Databases.Exclude) > 0 {
+		databaseExcludePatterns = cfg.Databases.Exclude
+	}
+
+	for name, profile := range cfg.TLSProfiles {
+		configTLSProfiles[name] = profile
+	}
+
+	for _, t := range cfg.Targets {
+		if err := t.validate(); err != nil {
+			return err
+		}
+		if _, ok := probeTargets[t.Name]; ok {
+			return fmt.Errorf("target %q is defined more than once", t.Name)
+		}
+		probeTargets[t.Name] = t
+	}
+
+	rewrites, err := compileLabelRewrites(cfg.LabelRewrites)
+	if err != nil {
+		return err
+	}
+	labelRewrites = rewrites
+
+	return nil
+}
+
+func (cfg *config) flagValues() map[string]string {
+	values := map[string]string{}
+	setString := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	// false is applied as well, the file can switch off a flag which defaults to true
+	setBool := func(name string, value bool) {
+		values[name] = strconv.FormatBool(value)
+	}
+
+	setString("ravendb-url", cfg.RavenDbURL)
+	if cfg.Port != 0 {
+		values["port"] = strconv.FormatUint(uint64(cfg.Port), 10)
+	}
+	setString("timeout", cfg.Timeout)
+	setString("collection-interval", cfg.CollectionInterval)
+	setBool("verbose", cfg.Verbose)
+	setBool("discover-cluster", cfg.DiscoverCluster)
+	setString("tls-reload-interval", cfg.TLSReloadInterval)
+	setString("web-config-file", cfg.WebConfigFile)
+
+	if cfg.TLS != nil {
+		setString("ca-cert", cfg.TLS.CACertFile)
+		setBool("use-auth", cfg.TLS.UseAuth)
+		setString("client-cert", cfg.TLS.ClientCertFile)
+		setString("client-key", cfg.TLS.ClientKeyFile)
+		setString("client-key-password", cfg.TLS.ClientKeyPassword)
+		setString("client-pfx", cfg.TLS.ClientPfxFile)
+		setString("client-pfx-password", cfg.TLS.ClientPfxPassword)
+	}
+
+	for name, enabled := range cfg.Collectors {
+		values["collector-"+name] = strconv.FormatBool(enabled)
+	}
+
+	return values
+}
+
+// explicitFlags returns the flags set on the commandline or with an env variable
+func explicitFlags(flags *flag.FlagSet) map[string]bool {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+func setFlags(flags *flag.FlagSet, values map[string]string, explicit map[string]bool) error {
+	for name, value := range values {
+		if explicit[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for --%s: %v", value, name, err)
+		}
+	}
+	return nil
+}
+
+func (t *target) validate() error {
+	if t == nil || t.Name == "" || t.URL == "" {
+		return errors.New("every target needs a name and url")
+	}
+	return nil
+}
+
+// validateTargets checks that the TLS profiles referenced by targets exist
+func validateTargets(profiles map[string]*tlsProfile) error {
+	for name, t := range probeTargets {
+		if t.TLSProfile == "" {
+			continue
+		}
+		if _, ok := profiles[t.TLSProfile]; !ok {
+			return fmt.Errorf("target %q uses unknown TLS profile %q", name, t.TLSProfile)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/namsral/flag"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := []byte(`
+ravendb_url: https://a.example.com
+timeout: 5s
+tls:
+  ca_cert: /certs/ca.crt
+  use_auth: true
+  client_pfx: /certs/client.pfx
+targets:
+  - name: staging
+    url: https://staging.example.com
+    tls_profile: staging
+databases:
+  include: ["glob:tenant-*", "Demo"]
+collectors:
+  storage: false
+`)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"ravendb-url":       "https://a.example.com",
+		"timeout":           "5s",
+		"verbose":           "false",
+		"discover-cluster":  "false",
+		"ca-cert":           "/certs/ca.crt",
+		"use-auth":          "true",
+		"client-pfx":        "/certs/client.pfx",
+		"collector-storage": "false",
+	}
+	if actual := cfg.flagValues(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected flag values %v but got %v", expected, actual)
+	}
+	if len(cfg.Targets) != 1 || cfg.Targets[0].URL != "https://staging.example.com" || cfg.Targets[0].TLSProfile != "staging" {
+		t.Errorf("Unexpected targets %v", cfg.Targets)
+	}
+	if !reflect.DeepEqual(cfg.Databases.Include, []string{"glob:tenant-*", "Demo"}) {
+		t.Errorf("Unexpected database include patterns %v", cfg.Databases.Include)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("ravendb_uri: https://a.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+}
+
+func TestExplicitFlagsOverrideConfig(t *testing.T) {
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	verbose := flags.Bool("verbose", false, "")
+	discoverCluster := flags.Bool("discover-cluster", false, "")
+	indexCollector := flags.Bool("collector-index", true, "")
+	storageCollector := flags.Bool("collector-storage", true, "")
+
+	if err := flags.Parse([]string{"-discover-cluster=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.ParseEnv([]string{"COLLECTOR_STORAGE=true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config{
+		Verbose:         true,
+		DiscoverCluster: true,
+		Collectors:      map[string]bool{"index": false, "storage": false},
+	}
+	if err := setFlags(flags, cfg.flagValues(), explicitFlags(flags)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !*verbose {
+		t.Error("Expected verbose from the config file")
+	}
+	if *discoverCluster {
+		t.Error("Expected --discover-cluster=false on the commandline to override the config file")
+	}
+	if *indexCollector {
+		t.Error("Expected the index collector to be switched off by the config file")
+	}
+	if !*storageCollector {
+		t.Error("Expected COLLECTOR_STORAGE=true to override the config file")
+	}
+}
+
+func TestRewriteLabels(t *testing.T) {
+	rewrites, err := compileLabelRewrites([]*labelRewrite{
+		{SourceLabel: "database", Regex: "tenant-(.*)", TargetLabel: "tenant"},
+		{SourceLabel: "node_tag", Replacement: "node-$1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mfs := []*dto.MetricFamily{{
+		Name: proto.String("ravendb_database_documents"),
+		Metric: []*dto.Metric{
+			{Label: []*dto.LabelPair{labelPair("database", "tenant-42"), labelPair("node_tag", "A")}},
+			{Label: []*dto.LabelPair{labelPair("database", "Demo")}},
+		},
+	}}
+
+	rewriteLabels(mfs, rewrites)
+
+	expected := [][]string{
+		{"database", "tenant-42", "node_tag", "node-A", "tenant", "42"},
+		{"database", "Demo"},
+	}
+	for i, m := range mfs[0].Metric {
+		var actual []string
+		for _, label := range m.Label {
+			actual = append(actual, label.GetName(), label.GetValue())
+		}
+		if !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("Expected labels %v but got %v", expected[i], actual)
+		}
+	}
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+}
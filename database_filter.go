@@ -0,0 +1,97 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const globPrefix = "glob:"
+
+// databaseFilter decides which databases are scraped. A database is scraped if it matches
+// any include pattern (or there are none) and does not match any exclude pattern.
+type databaseFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newDatabaseFilter(include []string, exclude []string) (*databaseFilter, error) {
+	filter := &databaseFilter{}
+	var err error
+
+	if filter.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func (f *databaseFilter) apply(databases []string) (included []string, skipped int) {
+	for _, database := range databases {
+		if f.matches(database) {
+			included = append(included, database)
+		} else {
+			skipped++
+		}
+	}
+	return
+}
+
+func (f *databaseFilter) matches(database string) bool {
+	if len(f.include) > 0 && !matchesAny(f.include, database) {
+		return false
+	}
+	return !matchesAny(f.exclude, database)
+}
+
+func matchesAny(patterns []*regexp.Regexp, database string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(database) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		regex, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+// compilePattern compiles a regex matching the whole database name, or a glob
+// supporting * and ? wildcards if the pattern starts with "glob:"
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, globPrefix) {
+		pattern = regexp.QuoteMeta(strings.TrimPrefix(pattern, globPrefix))
+		pattern = strings.Replace(pattern, `\*`, ".*", -1)
+		pattern = strings.Replace(pattern, `\?`, ".", -1)
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// patternList is a repeatable flag, every occurrence adds one pattern. Patterns can contain
+// commas (e.g. a{1,3}), so a single value is only split on newlines, which lets an env
+// variable hold several patterns
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, "\n")
+}
+
+func (l *patternList) Set(value string) error {
+	for _, pattern := range strings.Split(value, "\n") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			*l = append(*l, pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDatabaseFilter(t *testing.T) {
+
+	databases := []string{"Demo", "tenant-1", "tenant-2", "tenant-archive", "System"}
+
+	testCases := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{"no filters", nil, nil, databases},
+		{"regex include", []string{"tenant-\\d+"}, nil, []string{"tenant-1", "tenant-2"}},
+		{"regex with repetition", []string{"tenant-\\d{1,3}"}, nil, []string{"tenant-1", "tenant-2"}},
+		{"glob include", []string{"glob:tenant-*"}, nil, []string{"tenant-1", "tenant-2", "tenant-archive"}},
+		{"glob exclude", nil, []string{"glob:tenant-?"}, []string{"Demo", "tenant-archive", "System"}},
+		{"include and exclude", []string{"glob:tenant-*", "Demo"}, []string{"tenant-archive"}, []string{"Demo", "tenant-1", "tenant-2"}},
+		{"regex must match whole name", []string{"tenant"}, nil, nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filter, err := newDatabaseFilter(testCase.include, testCase.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			included, skipped := filter.apply(databases)
+			if !reflect.DeepEqual(included, testCase.expected) {
+				t.Errorf("Expected databases %v but got %v", testCase.expected, included)
+			}
+			if skipped != len(databases)-len(testCase.expected) {
+				t.Errorf("Expected %d skipped databases but got %d", len(databases)-len(testCase.expected), skipped)
+			}
+		})
+	}
+}
+
+func TestPatternList(t *testing.T) {
+
+	var patterns patternList
+	for _, value := range []string{"tenant-\\d{1,3}", "glob:a,b", "Demo\n System \n"} {
+		if err := patterns.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := patternList{"tenant-\\d{1,3}", "glob:a,b", "Demo", "System"}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Errorf("Expected patterns %v but got %v", expected, patterns)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+type clusterNode struct {
+	tag      string
+	url      string
+	provider *statsProvider
+	registry *prometheus.Registry
+}
+
+// clusterDiscovery reads the cluster topology on every gather and scrapes each node
+// found in it, so nodes joining or leaving the cluster are picked up without a restart.
+type clusterDiscovery struct {
+	seed      *ravenDbClient
+	transport http.RoundTripper
+
+	mutex     sync.Mutex
+	clusterID string
+	nodes     map[string]*clusterNode
+}
+
+func newClusterDiscovery(seed *ravenDbClient, transport http.RoundTripper) *clusterDiscovery {
+	return &clusterDiscovery{
+		seed:      seed,
+		transport: transport,
+		nodes:     make(map[string]*clusterNode),
+	}
+}
+
+func (d *clusterDiscovery) Gather() ([]*dto.MetricFamily, error) {
+	d.refreshTopology()
+
+	d.mutex.Lock()
+	clusterID := d.clusterID
+	var nodes []*clusterNode
+	for _, node := range d.nodes {
+		nodes = append(nodes, node)
+	}
+	d.mutex.Unlock()
+
+	results := make([]prometheus.Gatherer, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *clusterNode) {
+			defer wg.Done()
+
+			mfs, err := node.registry.Gather()
+			addLabels(mfs, map[string]string{
+				"node_tag":   node.tag,
+				"cluster_id": clusterID,
+			})
+			results[i] = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, err })
+		}(i, node)
+	}
+	wg.Wait()
+
+	return prometheus.Gatherers(results).Gather()
+}
+
+func (d *clusterDiscovery) refreshTopology() {
+	topology, err := d.seed.getClusterTopology()
+	if err != nil {
+		log.WithError(err).WithField("seed", d.seed.url).Warn("Error while getting cluster topology from seed node, trying known nodes")
+
+		for _, url := range d.knownNodeURLs() {
+			if topology, err = newRavenDbClient(url, d.transport).getClusterTopology(); err == nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		log.WithError(err).Error("Error while getting cluster topology, using last known topology")
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.clusterID = topology.clusterID
+
+	for tag, node := range d.nodes {
+		if url, ok := topology.nodes[tag]; !ok || url != node.url {
+			log.WithFields(logrus.Fields{"node": tag, "url": node.url}).Info("Node left the cluster")
+			node.provider.stop()
+			delete(d.nodes, tag)
+		}
+	}
+
+	for tag, url := range topology.nodes {
+		if _, ok := d.nodes[tag]; ok {
+			continue
+		}
+
+		log.WithFields(logrus.Fields{"node": tag, "url": url}).Info("Discovered cluster node")
+
+		provider := newStatsProvider(newRavenDbClient(url, d.transport), collectionInterval)
+		provider.start()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newExporter(provider))
+
+		d.nodes[tag] = &clusterNode{
+			tag:      tag,
+			url:      url,
+			provider: provider,
+			registry: registry,
+		}
+	}
+}
+
+func (d *clusterDiscovery) knownNodeURLs() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var urls []string
+	for _, node := range d.nodes {
+		urls = append(urls, node.url)
+	}
+	return urls
+}
+
+// addLabels adds the labels of the scraped node to every metric. A label the metric already has is
+// kept as exported_<name>, the way Prometheus resolves conflicts with target labels
+func addLabels(mfs []*dto.MetricFamily, labels map[string]string) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, pair := range m.Label {
+				if _, ok := labels[pair.GetName()]; ok {
+					pair.Name = proto.String("exported_" + pair.GetName())
+				}
+			}
+			for name, value := range labels {
+				m.Label = append(m.Label, &dto.LabelPair{
+					Name:  proto.String(name),
+					Value: proto.String(value),
+				})
+			}
+			sort.Sort(prometheus.LabelPairSorter(m.Label))
+		}
+	}
+}
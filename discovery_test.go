@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeTopology is the cluster topology served by every node of a fake cluster
+type fakeTopology struct {
+	mutex sync.Mutex
+	nodes map[string]string
+}
+
+func (f *fakeTopology) set(nodes map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.nodes = nodes
+}
+
+func (f *fakeTopology) json() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var members []string
+	for tag, url := range f.nodes {
+		members = append(members, fmt.Sprintf("%q: %q", tag, url))
+	}
+	return fmt.Sprintf(`{"Topology": {"TopologyId": "cluster-1", "Members": {%s}}, "CurrentState": "Follower"}`, strings.Join(members, ", "))
+}
+
+func newFakeClusterNode(t *testing.T, topology *fakeTopology) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case clusterTopologyEndpoint:
+			w.Write([]byte(topology.json())) // nolint: errcheck
+		case databasesEndpoint:
+			w.Write([]byte(`{"Databases": []}`)) // nolint: errcheck
+		default:
+			w.Write([]byte(`{}`)) // nolint: errcheck
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAddLabelsKeepsExistingLabelsAsExported(t *testing.T) {
+
+	mfs := []*dto.MetricFamily{{
+		Name: proto.String("ravendb_cluster_node_state"),
+		Metric: []*dto.Metric{
+			{Label: []*dto.LabelPair{labelPair("node_tag", "B"), labelPair("state", "Member")}},
+		},
+	}}
+
+	addLabels(mfs, map[string]string{"node_tag": "A", "cluster_id": "c"})
+
+	expected := []*dto.LabelPair{
+		labelPair("cluster_id", "c"),
+		labelPair("exported_node_tag", "B"),
+		labelPair("node_tag", "A"),
+		labelPair("state", "Member"),
+	}
+	if !reflect.DeepEqual(mfs[0].Metric[0].Label, expected) {
+		t.Errorf("Expected labels %v but got %v", expected, mfs[0].Metric[0].Label)
+	}
+}
+
+func TestClusterDiscoveryFollowsTopology(t *testing.T) {
+
+	topology := &fakeTopology{}
+	nodeA := newFakeClusterNode(t, topology)
+	nodeB := newFakeClusterNode(t, topology)
+	nodeC := newFakeClusterNode(t, topology)
+	topology.set(map[string]string{"A": nodeA.URL, "B": nodeB.URL})
+
+	discovery := newClusterDiscovery(newRavenDbClient(nodeA.URL, http.DefaultTransport), http.DefaultTransport)
+	defer stopClusterNodes(discovery)
+
+	mfs, err := discovery.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDiscoveredNodes(t, discovery, map[string]string{"A": nodeA.URL, "B": nodeB.URL})
+	assertNodeTags(t, mfs, "A", "B")
+
+	first := discovery.nodes["A"]
+	second := discovery.nodes["B"]
+
+	// B is replaced by C, A moves to another URL
+	topology.set(map[string]string{"A": nodeC.URL, "C": nodeB.URL})
+
+	mfs, err = discovery.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDiscoveredNodes(t, discovery, map[string]string{"A": nodeC.URL, "C": nodeB.URL})
+	assertNodeTags(t, mfs, "A", "C")
+
+	for _, node := range []*clusterNode{first, second} {
+		if !isStopped(node.provider) {
+			t.Errorf("Expected stats provider of the removed node %s at %s to be stopped", node.tag, node.url)
+		}
+	}
+	if discovery.nodes["A"] == first || isStopped(discovery.nodes["A"].provider) {
+		t.Error("Expected a new stats provider for the node that moved to another URL")
+	}
+}
+
+func TestClusterDiscoveryFallsBackToKnownNodes(t *testing.T) {
+
+	topology := &fakeTopology{}
+	seed := newFakeClusterNode(t, topology)
+	nodeB := newFakeClusterNode(t, topology)
+	nodeC := newFakeClusterNode(t, topology)
+	topology.set(map[string]string{"A": seed.URL, "B": nodeB.URL})
+
+	discovery := newClusterDiscovery(newRavenDbClient(seed.URL, http.DefaultTransport), http.DefaultTransport)
+	defer stopClusterNodes(discovery)
+
+	discovery.refreshTopology()
+	assertDiscoveredNodes(t, discovery, map[string]string{"A": seed.URL, "B": nodeB.URL})
+
+	seed.Close()
+	topology.set(map[string]string{"A": seed.URL, "B": nodeB.URL, "C": nodeC.URL})
+
+	discovery.refreshTopology()
+	assertDiscoveredNodes(t, discovery, map[string]string{"A": seed.URL, "B": nodeB.URL, "C": nodeC.URL})
+
+	nodeB.Close()
+	nodeC.Close()
+
+	// without any reachable node the last known topology stays in use
+	discovery.refreshTopology()
+	assertDiscoveredNodes(t, discovery, map[string]string{"A": seed.URL, "B": nodeB.URL, "C": nodeC.URL})
+}
+
+func assertDiscoveredNodes(t *testing.T, discovery *clusterDiscovery, expected map[string]string) {
+	t.Helper()
+
+	discovered := map[string]string{}
+	for tag, node := range discovery.nodes {
+		discovered[tag] = node.url
+	}
+	if !reflect.DeepEqual(discovered, expected) {
+		t.Errorf("Expected nodes %v but got %v", expected, discovered)
+	}
+}
+
+// assertNodeTags checks that ravendb_up is reported once for every node and that no metric has a label twice
+func assertNodeTags(t *testing.T, mfs []*dto.MetricFamily, expected ...string) {
+	t.Helper()
+
+	var tags []string
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			names := map[string]bool{}
+			for _, label := range m.Label {
+				if names[label.GetName()] {
+					t.Errorf("Metric %s has label %s twice", mf.GetName(), label.GetName())
+				}
+				names[label.GetName()] = true
+
+				if mf.GetName() == "ravendb_up" && label.GetName() == "node_tag" {
+					tags = append(tags, label.GetValue())
+				}
+			}
+		}
+	}
+
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected ravendb_up for nodes %v but got %v", expected, tags)
+	}
+}
+
+func isStopped(provider *statsProvider) bool {
+	select {
+	case <-provider.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func stopClusterNodes(discovery *clusterDiscovery) {
+	for _, node := range discovery.nodes {
+		node.provider.stop()
+	}
+}
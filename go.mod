@@ -4,22 +4,24 @@ go 1.20
 
 require (
 	github.com/buger/jsonparser v1.1.1
+	github.com/golang/protobuf v1.0.0
 	github.com/namsral/flag v1.7.4-pre
 	github.com/prometheus/client_golang v0.8.0
+	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5
 	github.com/sirupsen/logrus v1.9.0
+	golang.org/x/crypto v0.11.0
+	golang.org/x/sync v0.1.0
+	gopkg.in/yaml.v2 v2.4.0
+	software.sslmate.com/src/go-pkcs12 v0.4.0
 )
 
 require (
 	github.com/beorn7/perks v0.0.0-20180321164747-3a771d992973 // indirect
-	github.com/golang/protobuf v1.0.0 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.0 // indirect
-	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5 // indirect
 	github.com/prometheus/common v0.0.0-20180312112859-e4aa40a9169a // indirect
 	github.com/prometheus/procfs v0.0.0-20180321230812-780932d4fbbe // indirect
 	github.com/stretchr/testify v1.8.2 // indirect
-	golang.org/x/crypto v0.0.0-20180403160946-b2aa35443fbc // indirect
-	golang.org/x/sync v0.1.0 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 )
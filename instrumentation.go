@@ -0,0 +1,83 @@
+package main
+
+import (
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const exporterSubsystem = "exporter"
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests to RavenDB",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"code"})
+
+	httpResponseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      "http_response_size_bytes",
+		Help:      "Size of HTTP response bodies returned by RavenDB",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	}, []string{"code"})
+
+	tlsReloadSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      "tls_last_reload_success",
+		Help:      "Whether the last reload of certificates of a TLS profile was successful",
+	}, []string{"profile"})
+
+	tlsReloadSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      "tls_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful reload of certificates of a TLS profile",
+	}, []string{"profile"})
+
+	clientCertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      "client_certificate_expiry_timestamp_seconds",
+		Help:      "Expiry timestamp of the loaded client certificate of a TLS profile",
+	}, []string{"profile"})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporterSubsystem,
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by version and Go version of the exporter",
+	}, []string{"version", "goversion"})
+)
+
+func registerExporterMetrics() {
+	prometheus.MustRegister(httpRequestDuration, httpResponseSize, buildInfo)
+	prometheus.MustRegister(tlsReloadSuccess, tlsReloadSuccessTimestamp, clientCertificateExpiry)
+
+	buildInfo.WithLabelValues(version, runtime.Version()).Set(1)
+}
+
+func observeHTTPRequest(statusCode int, size int, duration time.Duration) {
+	code := statusCodeLabel(statusCode)
+
+	httpRequestDuration.WithLabelValues(code).Observe(duration.Seconds())
+	if statusCode != 0 {
+		httpResponseSize.WithLabelValues(code).Observe(float64(size))
+	}
+}
+
+func statusCodeLabel(statusCode int) string {
+	if statusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(statusCode)
+}
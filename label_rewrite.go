@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var labelRewrites []*labelRewrite
+
+// labelRewrite sets the target label to the replacement when the value of the source label
+// matches the regex, in the style of Prometheus relabeling. The replacement can refer to regex
+// groups with $1, ${name} etc. and defaults to $1. An empty result removes the target label.
+type labelRewrite struct {
+	SourceLabel string `yaml:"source_label"`
+	Regex       string `yaml:"regex"`
+	TargetLabel string `yaml:"target_label"`
+	Replacement string `yaml:"replacement"`
+
+	regex *regexp.Regexp
+}
+
+func compileLabelRewrites(rewrites []*labelRewrite) ([]*labelRewrite, error) {
+	for i, rewrite := range rewrites {
+		if rewrite == nil || rewrite.SourceLabel == "" {
+			return nil, fmt.Errorf("label rewrite %d: source_label is required", i)
+		}
+		if rewrite.TargetLabel == "" {
+			rewrite.TargetLabel = rewrite.SourceLabel
+		}
+		if rewrite.Regex == "" {
+			rewrite.Regex = "(.*)"
+		}
+		if rewrite.Replacement == "" {
+			rewrite.Replacement = "$1"
+		}
+
+		regex, err := regexp.Compile("^(?:" + rewrite.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("label rewrite %d: %v", i, err)
+		}
+		rewrite.regex = regex
+	}
+	return rewrites, nil
+}
+
+// rewritingGatherer applies the label rewrites to everything gathered by the wrapped gatherer
+type rewritingGatherer struct {
+	gatherer prometheus.Gatherer
+	rewrites []*labelRewrite
+}
+
+func withLabelRewrites(gatherer prometheus.Gatherer) prometheus.Gatherer {
+	if len(labelRewrites) == 0 {
+		return gatherer
+	}
+	return &rewritingGatherer{gatherer: gatherer, rewrites: labelRewrites}
+}
+
+func (g *rewritingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.gatherer.Gather()
+	rewriteLabels(mfs, g.rewrites)
+	return mfs, err
+}
+
+func rewriteLabels(mfs []*dto.MetricFamily, rewrites []*labelRewrite) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, rewrite := range rewrites {
+				m.Label = rewrite.apply(m.Label)
+			}
+			sort.Sort(prometheus.LabelPairSorter(m.Label))
+		}
+	}
+}
+
+func (r *labelRewrite) apply(labels []*dto.LabelPair) []*dto.LabelPair {
+	var source *dto.LabelPair
+	for _, label := range labels {
+		if label.GetName() == r.SourceLabel {
+			source = label
+			break
+		}
+	}
+	if source == nil {
+		return labels
+	}
+
+	match := r.regex.FindStringSubmatchIndex(source.GetValue())
+	if match == nil {
+		return labels
+	}
+	value := string(r.regex.ExpandString(nil, r.Replacement, source.GetValue(), match))
+
+	rewritten := labels[:0]
+	for _, label := range labels {
+		if label.GetName() != r.TargetLabel {
+			rewritten = append(rewritten, label)
+		}
+	}
+	if value != "" {
+		rewritten = append(rewritten, &dto.LabelPair{
+			Name:  proto.String(r.TargetLabel),
+			Value: proto.String(value),
+		})
+	}
+	return rewritten
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func serveProbe() {
+	http.HandleFunc("/probe", handleProbe)
+}
+
+func handleProbe(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	profile := r.URL.Query().Get("profile")
+
+	// targets defined in the config file can be referred to by name
+	if t, ok := probeTargets[target]; ok {
+		target = t.URL
+		if profile == "" {
+			profile = t.TLSProfile
+		}
+	}
+
+	if profile == "" {
+		profile = defaultTLSProfileName
+	}
+
+	transport, ok := transports[profile]
+	if !ok {
+		http.Error(w, "Unknown profile "+profile, http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newProbeExporter(newStatsProvider(newRavenDbClient(target, transport), 0)))
+
+	metricsHandler(registry).ServeHTTP(w, r)
+}
+
+// newProbeExporter leaves out ravendb_cluster_term_changes_total, which is derived from the term seen
+// in the previous scrape. Every probe creates a new exporter, so it would always be 0.
+func newProbeExporter(provider *statsProvider) *exporter {
+	e := newExporter(provider)
+	e.clusterTermChanges = nil
+	return e
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTransport counts the requests sent through a TLS profile
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestProbe(t *testing.T) {
+
+	server := newFakeRavenDbServer(t)
+
+	defaultTransport := &countingTransport{}
+	customTransport := &countingTransport{}
+	setProbeConfig(t, map[string]http.RoundTripper{
+		defaultTLSProfileName: defaultTransport,
+		"custom":              customTransport,
+	}, map[string]*target{
+		"demo": {Name: "demo", URL: server.URL, TLSProfile: "custom"},
+	})
+
+	testCases := []struct {
+		name              string
+		query             string
+		expectedStatus    int
+		expectedTransport *countingTransport
+	}{
+		{"missing target", "", http.StatusBadRequest, nil},
+		{"unknown profile", "target=" + server.URL + "&profile=other", http.StatusBadRequest, nil},
+		{"URL target uses default profile", "target=" + server.URL, http.StatusOK, defaultTransport},
+		{"URL target with profile", "target=" + server.URL + "&profile=custom", http.StatusOK, customTransport},
+		{"named target uses its profile", "target=demo", http.StatusOK, customTransport},
+		{"named target with profile", "target=demo&profile=default", http.StatusOK, defaultTransport},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			atomic.StoreInt32(&defaultTransport.requests, 0)
+			atomic.StoreInt32(&customTransport.requests, 0)
+
+			response := probe(testCase.query)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("Expected status %d but got %d: %s", testCase.expectedStatus, response.Code, response.Body.String())
+			}
+			if testCase.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if !strings.Contains(response.Body.String(), "\nravendb_up 1\n") {
+				t.Errorf("Expected ravendb_up 1 in the probe response")
+			}
+			for _, transport := range []*countingTransport{defaultTransport, customTransport} {
+				requests := atomic.LoadInt32(&transport.requests)
+				if transport == testCase.expectedTransport && requests == 0 {
+					t.Error("Expected RavenDB to be called with the chosen TLS profile")
+				}
+				if transport != testCase.expectedTransport && requests != 0 {
+					t.Error("Expected RavenDB not to be called with other TLS profiles")
+				}
+			}
+		})
+	}
+}
+
+func TestProbeUnreachableTarget(t *testing.T) {
+
+	server := newFakeRavenDbServer(t)
+	url := server.URL
+	server.Close()
+
+	setProbeConfig(t, map[string]http.RoundTripper{defaultTLSProfileName: http.DefaultTransport}, nil)
+
+	response := probe("target=" + url)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected status %d but got %d", http.StatusOK, response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "\nravendb_up 0\n") {
+		t.Errorf("Expected ravendb_up 0 in the probe response")
+	}
+}
+
+func probe(query string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	handleProbe(response, httptest.NewRequest(http.MethodGet, "/probe?"+query, nil))
+	return response
+}
+
+func setProbeConfig(t *testing.T, probeTransports map[string]http.RoundTripper, targets map[string]*target) {
+	previousTransports, previousTargets := transports, probeTargets
+	t.Cleanup(func() {
+		transports, probeTargets = previousTransports, previousTargets
+	})
+
+	transports = probeTransports
+	probeTargets = map[string]*target{}
+	for name, target := range targets {
+		probeTargets[name] = target
+	}
+}
+
+// newFakeRavenDbServer serves an empty database list and an empty object for every other endpoint
+func newFakeRavenDbServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == databasesEndpoint {
+			w.Write([]byte(`{"Databases": []}`)) // nolint: errcheck
+			return
+		}
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
@@ -1,132 +1,338 @@
 package main
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	jp "github.com/buger/jsonparser"
+	"github.com/sirupsen/logrus"
 )
 
-var (
-	client http.Client
-)
+type ravenDbClient struct {
+	url    string
+	client *http.Client
+
+	mutex           sync.Mutex
+	peerCertificate *x509.Certificate
+}
 
 type stats struct {
-	cpu      []byte
-	memory   []byte
-	metrics  []byte
-	nodeInfo []byte
-	dbStats  []*dbStats
+	cpu              []byte
+	serverMonitoring []byte
+	memory           []byte
+	metrics          []byte
+	nodeInfo         []byte
+	dbStats          []*dbStats
+
+	certificates      []byte
+	serverCertificate *x509.Certificate
+
+	licenseStatus   []byte
+	clusterTopology []byte
+	clusterLog      []byte
+
+	endpoints        []getResult
+	skippedDatabases int
 }
 
 type dbStats struct {
 	database        string
+	record          []byte
 	collectionStats []byte
+	collectionSizes []byte
 	metrics         []byte
 	indexes         []byte
 	databaseStats   []byte
 	storage         []byte
 	tasks           []byte
-}
+	backupStatuses  map[string][]byte
 
-func initializeClient() {
+	replicationOutgoing []byte
+	replicationFailures []byte
+	replicationIncoming []byte
 
-	transport := &http.Transport{TLSClientConfig: prepareTLSConfig()}
+	etlStats    []byte
+	etlProgress []byte
 
-	client = http.Client{
-		Transport: transport,
-		Timeout:   timeout,
+	subscriptions           []byte
+	subscriptionPerformance []byte
+	subscriptionConnections map[string][]byte
+}
+
+func newRavenDbClient(url string, transport http.RoundTripper) *ravenDbClient {
+	return &ravenDbClient{
+		url: url,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
 	}
+}
+
+const (
+	databasesEndpoint = "/databases"
+
+	cpuStatsEndpoint    = "/admin/debug/cpu/stats"
+	memoryStatsEndpoint = "/admin/debug/memory/stats"
+	metricsEndpoint     = "/admin/metrics"
+	nodeInfoEndpoint    = "/cluster/node-info"
+
+	serverMonitoringEndpoint = "/admin/monitoring/v1/server"
+
+	certificatesEndpoint    = "/admin/certificates?metadataOnly=true"
+	licenseStatusEndpoint   = "/license/status"
+	clusterTopologyEndpoint = "/cluster/topology"
+	clusterLogEndpoint      = "/admin/cluster/log?take=0"
+
+	collectionStatsEndpoint = "/databases/{database}/collections/stats"
+	collectionSizesEndpoint = "/databases/{database}/collections/stats/detailed"
+	indexStatsEndpoint      = "/databases/{database}/indexes/stats"
+	databaseMetricsEndpoint = "/databases/{database}/metrics"
+	databaseStatsEndpoint   = "/databases/{database}/stats"
+	storageReportEndpoint   = "/databases/{database}/debug/storage/report"
+	tasksEndpoint           = "/databases/{database}/tasks"
+	backupStatusEndpoint    = "/databases/{database}/periodic-backup/status?taskId={task}"
+
+	replicationOutgoingEndpoint = "/databases/{database}/replication/debug/outgoing-handlers"
+	replicationFailuresEndpoint = "/databases/{database}/replication/outgoing-failures"
+	replicationIncomingEndpoint = "/databases/{database}/replication/incoming-last-activity-time"
+
+	etlStatsEndpoint    = "/databases/{database}/etl/stats"
+	etlProgressEndpoint = "/databases/{database}/etl/progress"
 
+	subscriptionsEndpoint           = "/databases/{database}/subscriptions"
+	subscriptionPerformanceEndpoint = "/databases/{database}/subscriptions/performance"
+	subscriptionConnectionsEndpoint = "/databases/{database}/subscriptions/connection-details?name={task}"
+)
+
+type request struct {
+	endpoint string
+	database string
+	task     string
 }
 
-func getStats() (*stats, error) {
+func (r request) path() string {
+	path := strings.Replace(r.endpoint, "{database}", r.database, 1)
+	return strings.Replace(path, "{task}", url.QueryEscape(r.task), 1)
+}
 
-	databases, err := getDatabaseNames()
-	if err != nil {
-		return nil, err
+func (c *ravenDbClient) getStats() (*stats, error) {
+
+	databases, databasesResult := c.getDatabaseNames()
+	if databasesResult.err != nil {
+		// endpoint results are still returned, so that the failure can be reported
+		return &stats{endpoints: []getResult{databasesResult}}, databasesResult.err
 	}
 
-	paths := preparePaths(databases)
+	databases, skipped := databaseFilters.apply(databases)
+
+	requests := prepareRequests(databases)
 
-	results := getAllPaths(paths, 16)
+	results := c.getAll(requests, 16)
+	results[databasesResult.request] = databasesResult
 
-	return organizeGetResults(results, databases)
+	// some endpoints are per task, so the tasks need to be known first
+	var taskRequests []request
+	if collectorEnabled(backupCollector) {
+		taskRequests = append(taskRequests, prepareBackupStatusRequests(results, databases)...)
+	}
+	if collectorEnabled(subscriptionCollector) {
+		taskRequests = append(taskRequests, prepareSubscriptionConnectionsRequests(results, databases)...)
+	}
+	for request, result := range c.getAll(taskRequests, 16) {
+		results[request] = result
+	}
+
+	stats := organizeGetResults(results, databases)
+	stats.skippedDatabases = skipped
+	stats.serverCertificate = c.getPeerCertificate()
+
+	return stats, nil
 }
 
-func getDatabaseNames() ([]string, error) {
-	data, err := get("/databases")
-	if err != nil {
-		return nil, err
+func (c *ravenDbClient) getDatabaseNames() ([]string, getResult) {
+	result := c.getTimed(request{endpoint: databasesEndpoint})
+	if result.err != nil {
+		return nil, result
 	}
 	var databases []string
 
-	dbsNode, _, _, _ := jp.Get(data, "Databases")
-	jp.ArrayEach(dbsNode, func(value []byte, dataType jp.ValueType, offset int, err error) {
-		database, _ := jp.GetString(value, "Name")
+	forEachDatabaseRecord(result.result, func(database string, record []byte) {
 		databases = append(databases, database)
 	})
 
-	return databases, nil
+	return databases, result
+}
+
+// forEachDatabaseRecord iterates the database records, including their topology, listed by the databases endpoint
+func forEachDatabaseRecord(data []byte, recordFunc func(database string, record []byte)) {
+	jp.ArrayEach(data, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		database, _ := jp.GetString(value, "Name")
+		recordFunc(database, value)
+	}, "Databases")
 }
 
-func preparePaths(databases []string) []string {
-	paths := []string{
-		"/admin/debug/cpu/stats",
-		"/admin/debug/memory/stats",
-		"/admin/metrics",
-		"/cluster/node-info",
+func prepareRequests(databases []string) []request {
+	var requests []request
+
+	if collectorEnabled(serverCollector) {
+		requests = append(requests, request{endpoint: nodeInfoEndpoint})
+	}
+	if collectorEnabled(serverCollector) || collectorEnabled(meterCollector) {
+		requests = append(requests, request{endpoint: metricsEndpoint})
+	}
+	if collectorEnabled(serverCollector) || collectorEnabled(cpuCollector) {
+		requests = append(requests, request{endpoint: cpuStatsEndpoint})
+	}
+	if collectorEnabled(cpuCollector) {
+		requests = append(requests, request{endpoint: serverMonitoringEndpoint})
+	}
+	if collectorEnabled(serverCollector) || collectorEnabled(memoryCollector) {
+		requests = append(requests, request{endpoint: memoryStatsEndpoint})
+	}
+	if collectorEnabled(certificateCollector) {
+		requests = append(requests, request{endpoint: certificatesEndpoint})
+	}
+	if collectorEnabled(licenseCollector) {
+		requests = append(requests, request{endpoint: licenseStatusEndpoint})
+	}
+	if collectorEnabled(licenseCollector) || collectorEnabled(clusterCollector) {
+		requests = append(requests, request{endpoint: clusterTopologyEndpoint})
+	}
+	if collectorEnabled(clusterCollector) {
+		requests = append(requests, request{endpoint: clusterLogEndpoint})
 	}
 
 	for _, database := range databases {
-		paths = append(paths, fmt.Sprintf("/databases/%s/collections/stats", database))
-		paths = append(paths, fmt.Sprintf("/databases/%s/indexes", database))
-		paths = append(paths, fmt.Sprintf("/databases/%s/metrics", database))
-		paths = append(paths, fmt.Sprintf("/databases/%s/stats", database))
-		paths = append(paths, fmt.Sprintf("/databases/%s/debug/storage/report", database))
-		paths = append(paths, fmt.Sprintf("/databases/%s/tasks", database))
+		if collectorEnabled(collectionCollector) {
+			requests = append(requests, request{endpoint: collectionStatsEndpoint, database: database})
+		}
+		if collectorEnabled(collectionSizeCollector) {
+			requests = append(requests, request{endpoint: collectionSizesEndpoint, database: database})
+		}
+		if collectorEnabled(indexCollector) {
+			requests = append(requests, request{endpoint: indexStatsEndpoint, database: database})
+		}
+		if collectorEnabled(databaseCollector) || collectorEnabled(meterCollector) {
+			requests = append(requests, request{endpoint: databaseMetricsEndpoint, database: database})
+		}
+		// database stats hold the last etag, which replication and subscription lag is computed from
+		if collectorEnabled(databaseCollector) || collectorEnabled(replicationCollector) || collectorEnabled(subscriptionCollector) {
+			requests = append(requests, request{endpoint: databaseStatsEndpoint, database: database})
+		}
+		if collectorEnabled(storageCollector) {
+			requests = append(requests, request{endpoint: storageReportEndpoint, database: database})
+		}
+		if collectorEnabled(tasksCollector) || collectorEnabled(backupCollector) {
+			requests = append(requests, request{endpoint: tasksEndpoint, database: database})
+		}
+		if collectorEnabled(replicationCollector) {
+			requests = append(requests, request{endpoint: replicationOutgoingEndpoint, database: database})
+			requests = append(requests, request{endpoint: replicationFailuresEndpoint, database: database})
+			requests = append(requests, request{endpoint: replicationIncomingEndpoint, database: database})
+		}
+		if collectorEnabled(etlCollector) {
+			requests = append(requests, request{endpoint: etlStatsEndpoint, database: database})
+			requests = append(requests, request{endpoint: etlProgressEndpoint, database: database})
+		}
+		if collectorEnabled(subscriptionCollector) {
+			requests = append(requests, request{endpoint: subscriptionsEndpoint, database: database})
+			requests = append(requests, request{endpoint: subscriptionPerformanceEndpoint, database: database})
+		}
 	}
 
-	return paths
+	return requests
 }
 
-func getAllPaths(paths []string, maxParallelism int) map[string]getResult {
+func prepareBackupStatusRequests(results map[request]getResult, databases []string) []request {
+	var requests []request
+
+	for _, database := range databases {
+		tasks := results[request{endpoint: tasksEndpoint, database: database}].result
+		forEachOngoingTask(tasks, func(task []byte) {
+			if taskType, _ := jp.GetString(task, "TaskType"); taskType != backupTaskType {
+				return
+			}
+			if taskID, err := jp.GetInt(task, "TaskId"); err == nil {
+				requests = append(requests, request{endpoint: backupStatusEndpoint, database: database, task: strconv.FormatInt(taskID, 10)})
+			}
+		})
+	}
+
+	return requests
+}
 
-	pathsChan := make(chan string)
-	resultChan := make(chan getResult, len(paths))
+func prepareSubscriptionConnectionsRequests(results map[request]getResult, databases []string) []request {
+	var requests []request
+
+	for _, database := range databases {
+		subscriptions := results[request{endpoint: subscriptionsEndpoint, database: database}].result
+		jp.ArrayEach(subscriptions, func(value []byte, dataType jp.ValueType, offset int, err error) {
+			if name, err := jp.GetString(value, "SubscriptionName"); err == nil {
+				requests = append(requests, request{endpoint: subscriptionConnectionsEndpoint, database: database, task: name})
+			}
+		}, "Results")
+	}
+
+	return requests
+}
+
+// forEachOngoingTask calls the function for every task in the response of the tasks endpoint
+func forEachOngoingTask(tasks []byte, taskFunc func(task []byte)) {
+	// Required for compatibility with versions 5 and 6
+	onGoingTasksKey := "OngoingTasks"
+	_, _, _, err := jp.Get(tasks, onGoingTasksKey)
+	if err != nil {
+		onGoingTasksKey = "OngoingTasksList"
+	}
+
+	jp.ArrayEach(tasks, func(value []byte, dataType jp.ValueType, offset int, err error) {
+		taskFunc(value)
+	}, onGoingTasksKey)
+}
+
+func (c *ravenDbClient) getAll(requests []request, maxParallelism int) map[request]getResult {
+
+	requestsChan := make(chan request)
+	resultChan := make(chan getResult, len(requests))
 
 	var doneChans []<-chan bool
 
 	for i := 0; i < maxParallelism; i++ {
-		doneChans = append(doneChans, getWorker(pathsChan, resultChan))
+		doneChans = append(doneChans, c.getWorker(requestsChan, resultChan))
 	}
 
-	for _, path := range paths {
-		pathsChan <- path
+	for _, request := range requests {
+		requestsChan <- request
 	}
-	close(pathsChan)
+	close(requestsChan)
 
 	for i := 0; i < maxParallelism; i++ {
 		<-doneChans[i]
 	}
 
-	allResults := make(map[string]getResult)
-	for i := 0; i < len(paths); i++ {
+	allResults := make(map[request]getResult)
+	for i := 0; i < len(requests); i++ {
 		result := <-resultChan
-		allResults[result.path] = result
+		allResults[result.request] = result
 	}
 
 	return allResults
 }
 
-func getWorker(paths <-chan string, results chan<- getResult) <-chan bool {
+func (c *ravenDbClient) getWorker(requests <-chan request, results chan<- getResult) <-chan bool {
 	done := make(chan bool)
 
 	go func() {
-		for path := range paths {
-			result, err := get(path)
-			results <- getResult{path, result, err}
+		for request := range requests {
+			results <- c.getTimed(request)
 		}
 		done <- true
 	}()
@@ -135,62 +341,176 @@ func getWorker(paths <-chan string, results chan<- getResult) <-chan bool {
 }
 
 type getResult struct {
-	path   string
-	result []byte
-	err    error
+	request    request
+	result     []byte
+	err        error
+	statusCode int
+	duration   time.Duration
+}
+
+func (c *ravenDbClient) getTimed(request request) getResult {
+	start := time.Now()
+	result, statusCode, err := c.getWithStatusCode(request.path())
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{
+			"target":   c.url,
+			"endpoint": request.endpoint,
+			"database": request.database,
+		}).Warn("Error while getting data from RavenDB endpoint")
+	}
+
+	return getResult{request, result, err, statusCode, time.Since(start)}
 }
 
-func get(path string) ([]byte, error) {
-	url := ravenDbURL + path
+func (c *ravenDbClient) get(path string) ([]byte, error) {
+	buf, _, err := c.getWithStatusCode(path)
+	return buf, err
+}
+
+// getWithStatusCode returns status code 0 if no response was received
+func (c *ravenDbClient) getWithStatusCode(path string) ([]byte, int, error) {
+	url := c.url + path
 
 	log.WithField("url", url).Debug("GET request to RavenDB")
 
-	response, err := client.Get(url)
+	start := time.Now()
+	response, err := c.client.Get(url)
 	if err != nil {
-		return nil, err
+		observeHTTPRequest(0, 0, time.Since(start))
+		return nil, 0, err
 	}
 	defer response.Body.Close()
 
+	if response.TLS != nil && len(response.TLS.PeerCertificates) > 0 {
+		c.setPeerCertificate(response.TLS.PeerCertificates[0])
+	}
+
 	buf, err := ioutil.ReadAll(response.Body)
+	observeHTTPRequest(response.StatusCode, len(buf), time.Since(start))
 	if err != nil {
-		return nil, err
+		return nil, response.StatusCode, err
 	}
 
 	if response.StatusCode >= 400 {
-		return nil, fmt.Errorf("Server responded with HTTP %d and body: %s", response.StatusCode, string(buf))
+		return nil, response.StatusCode, fmt.Errorf("Server responded with HTTP %d and body: %s", response.StatusCode, string(buf))
 	}
 
-	return buf, nil
+	return buf, response.StatusCode, nil
 }
 
-func organizeGetResults(results map[string]getResult, databases []string) (*stats, error) {
+func (c *ravenDbClient) setPeerCertificate(certificate *x509.Certificate) {
+	c.mutex.Lock()
+	c.peerCertificate = certificate
+	c.mutex.Unlock()
+}
 
-	for _, result := range results {
-		if result.err != nil {
-			return nil, result.err
-		}
-	}
+// getPeerCertificate returns the certificate the server presented in the last TLS handshake
+func (c *ravenDbClient) getPeerCertificate() *x509.Certificate {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.peerCertificate
+}
+
+func organizeGetResults(results map[request]getResult, databases []string) *stats {
 
 	stats := stats{
-		cpu:      results["/admin/debug/cpu/stats"].result,
-		memory:   results["/admin/debug/memory/stats"].result,
-		metrics:  results["/admin/metrics"].result,
-		nodeInfo: results["/cluster/node-info"].result,
+		cpu:              results[request{endpoint: cpuStatsEndpoint}].result,
+		serverMonitoring: results[request{endpoint: serverMonitoringEndpoint}].result,
+		memory:           results[request{endpoint: memoryStatsEndpoint}].result,
+		metrics:          results[request{endpoint: metricsEndpoint}].result,
+		nodeInfo:         results[request{endpoint: nodeInfoEndpoint}].result,
+
+		certificates:    results[request{endpoint: certificatesEndpoint}].result,
+		licenseStatus:   results[request{endpoint: licenseStatusEndpoint}].result,
+		clusterTopology: results[request{endpoint: clusterTopologyEndpoint}].result,
+		clusterLog:      results[request{endpoint: clusterLogEndpoint}].result,
 	}
 
+	records := make(map[string][]byte)
+	forEachDatabaseRecord(results[request{endpoint: databasesEndpoint}].result, func(database string, record []byte) {
+		records[database] = record
+	})
+
+	backupStatuses := groupTaskResults(results, backupStatusEndpoint)
+	subscriptionConnections := groupTaskResults(results, subscriptionConnectionsEndpoint)
+
 	for _, database := range databases {
 		dbs := &dbStats{
 			database:        database,
-			collectionStats: results[fmt.Sprintf("/databases/%s/collections/stats", database)].result,
-			indexes:         results[fmt.Sprintf("/databases/%s/indexes", database)].result,
-			metrics:         results[fmt.Sprintf("/databases/%s/metrics", database)].result,
-			databaseStats:   results[fmt.Sprintf("/databases/%s/stats", database)].result,
-			storage:         results[fmt.Sprintf("/databases/%s//debug/storage/report", database)].result,
-			tasks:           results[fmt.Sprintf("/databases/%s/tasks", database)].result,
+			record:          records[database],
+			collectionStats: results[request{endpoint: collectionStatsEndpoint, database: database}].result,
+			collectionSizes: results[request{endpoint: collectionSizesEndpoint, database: database}].result,
+			indexes:         results[request{endpoint: indexStatsEndpoint, database: database}].result,
+			metrics:         results[request{endpoint: databaseMetricsEndpoint, database: database}].result,
+			databaseStats:   results[request{endpoint: databaseStatsEndpoint, database: database}].result,
+			storage:         results[request{endpoint: storageReportEndpoint, database: database}].result,
+			tasks:           results[request{endpoint: tasksEndpoint, database: database}].result,
+			backupStatuses:  backupStatuses[database],
+
+			replicationOutgoing: results[request{endpoint: replicationOutgoingEndpoint, database: database}].result,
+			replicationFailures: results[request{endpoint: replicationFailuresEndpoint, database: database}].result,
+			replicationIncoming: results[request{endpoint: replicationIncomingEndpoint, database: database}].result,
+
+			etlStats:    results[request{endpoint: etlStatsEndpoint, database: database}].result,
+			etlProgress: results[request{endpoint: etlProgressEndpoint, database: database}].result,
+
+			subscriptions:           results[request{endpoint: subscriptionsEndpoint, database: database}].result,
+			subscriptionPerformance: results[request{endpoint: subscriptionPerformanceEndpoint, database: database}].result,
+			subscriptionConnections: subscriptionConnections[database],
 		}
 
 		stats.dbStats = append(stats.dbStats, dbs)
 	}
 
-	return &stats, nil
+	for _, result := range results {
+		stats.endpoints = append(stats.endpoints, result)
+	}
+
+	return &stats
+}
+
+// groupTaskResults returns successful results of a per task endpoint by database and task
+func groupTaskResults(results map[request]getResult, endpoint string) map[string]map[string][]byte {
+	grouped := make(map[string]map[string][]byte)
+	for request, result := range results {
+		if request.endpoint != endpoint || result.err != nil {
+			continue
+		}
+		if grouped[request.database] == nil {
+			grouped[request.database] = make(map[string][]byte)
+		}
+		grouped[request.database][request.task] = result.result
+	}
+	return grouped
+}
+
+type clusterTopology struct {
+	clusterID string
+	nodes     map[string]string
+}
+
+func (c *ravenDbClient) getClusterTopology() (*clusterTopology, error) {
+	data, err := c.get(clusterTopologyEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := &clusterTopology{
+		nodes: make(map[string]string),
+	}
+	topology.clusterID, _ = jp.GetString(data, "Topology", "TopologyId")
+
+	for _, section := range []string{"Members", "Promotables", "Watchers"} {
+		jp.ObjectEach(data, func(key []byte, value []byte, dataType jp.ValueType, offset int) error {
+			topology.nodes[string(key)] = string(value)
+			return nil
+		}, "Topology", section)
+	}
+
+	if len(topology.nodes) == 0 {
+		return nil, fmt.Errorf("Cluster topology returned by %s does not contain any nodes", c.url)
+	}
+
+	return topology, nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"time"
@@ -16,9 +17,15 @@ import (
 var (
 	log = logrus.New()
 
-	timeout time.Duration
-	port    uint
-	verbose bool
+	timeout            time.Duration
+	collectionInterval time.Duration
+	port               uint
+	verbose            bool
+	discoverCluster    bool
+
+	databaseIncludePatterns patternList
+	databaseExcludePatterns patternList
+	databaseFilters         = &databaseFilter{}
 
 	ravenDbURL        string
 	caCertFile        string
@@ -26,6 +33,10 @@ var (
 	clientCertFile    string
 	clientKeyFile     string
 	clientKeyPassword string
+	clientPfxFile     string
+	clientPfxPassword string
+	tlsProfilesFile   string
+	tlsReloadInterval time.Duration
 )
 
 func serveLandingPage() {
@@ -34,6 +45,7 @@ func serveLandingPage() {
 		<body>
 		<h1>RavenDB exporter for Prometheus</h1>
 		<p><a href='/metrics'>Metrics</a></p>
+		<p>Probe other RavenDB servers with <code>/probe?target=https://node.example.com&amp;profile=default</code></p>
 		</body>
 		</html>
 		`)
@@ -44,40 +56,98 @@ func serveLandingPage() {
 }
 
 func serveMetrics() {
-	prometheus.MustRegister(newExporter())
+	transport := transports[defaultTLSProfileName]
+	client := newRavenDbClient(ravenDbURL, transport)
+
+	if discoverCluster {
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, newClusterDiscovery(client, transport)}
+		http.Handle("/metrics", metricsHandler(gatherers))
+		return
+	}
+
+	provider := newStatsProvider(client, collectionInterval)
+	provider.start()
+
+	prometheus.MustRegister(newExporter(provider))
+
+	http.Handle("/metrics", metricsHandler(prometheus.DefaultGatherer))
+}
 
-	http.Handle("/metrics", promhttp.Handler())
+func metricsHandler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(withLabelRewrites(gatherer), promhttp.HandlerOpts{})
 }
 
 func readAndValidateConfig() {
 	flag.String(flag.DefaultConfigFlagname, "", "path to config file")
+	flag.StringVar(&configFile, "config-file", "", "(optional) Path to YAML config file, explicitly set flags and env variables override its settings")
+	flag.BoolVar(&checkConfig, "config.check", false, "Validate the configuration and exit")
 	flag.StringVar(&ravenDbURL, "ravendb-url", "http://localhost:8080", "RavenDB URL")
 	flag.UintVar(&port, "port", 9440, "Port to expose scraping endpoint on")
 	flag.DurationVar(&timeout, "timeout", time.Second*10, "Timeout when calling RavenDB")
+	flag.DurationVar(&collectionInterval, "collection-interval", 0, "If set, RavenDB is scraped in the background on this interval and /metrics serves the latest snapshot")
 	flag.BoolVar(&verbose, "verbose", false, "Enable verbose logging")
+	flag.Var(&databaseIncludePatterns, "database-include", "(optional) Regex or glob: pattern, only matching databases are scraped, repeat the flag for more patterns")
+	flag.Var(&databaseExcludePatterns, "database-exclude", "(optional) Regex or glob: pattern, matching databases are not scraped, repeat the flag for more patterns")
+	for _, name := range collectorNames {
+		collectorToggles[name] = flag.Bool("collector-"+name, !collectorsDisabledByDefault[name], fmt.Sprintf("Enable the %s collector", name))
+	}
+	flag.BoolVar(&discoverCluster, "discover-cluster", false, "If set, RavenDB URL is used as a seed to discover and scrape all nodes of the cluster")
 
 	flag.StringVar(&caCertFile, "ca-cert", "", "Path to CA public cert file of RavenDB server")
 	flag.BoolVar(&useAuth, "use-auth", false, "If set, connection to RavenDB will be authenticated with a client certificate")
 	flag.StringVar(&clientCertFile, "client-cert", "", "Path to client public certificate used for authentication")
 	flag.StringVar(&clientKeyFile, "client-key", "", "Path to client private key used for authentication")
 	flag.StringVar(&clientKeyPassword, "client-key-password", "", "(optional) Password for the client private keys")
+	flag.StringVar(&clientPfxFile, "client-pfx", "", "Path to PKCS#12 (.pfx) bundle with client certificate and private key, used instead of --client-cert and --client-key")
+	flag.StringVar(&clientPfxPassword, "client-pfx-password", "", "(optional) Password for the PKCS#12 bundle")
+	flag.DurationVar(&tlsReloadInterval, "tls-reload-interval", time.Minute, "Interval of checking certificate and web config files for changes, 0 disables checking (they are still reloaded on SIGHUP)")
+	flag.StringVar(&webConfigFile, "web-config-file", "", "(optional) Path to web config file with TLS and basic auth settings of the metrics endpoint")
+	flag.StringVar(&tlsProfilesFile, "tls-profiles-file", "", "(optional) Path to YAML file with named TLS profiles used by the /probe endpoint")
 
 	flag.Parse()
 
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			log.Fatal("Invalid configuration: error while reading config file: ", err)
+		}
+		if err := applyConfig(cfg); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+
 	log.WithFields(logrus.Fields{
-		"ravenDbUrl": ravenDbURL,
-		"caCert":     caCertFile,
-		"useAuth":    useAuth,
-		"clientCert": clientCertFile,
-		"clientKey":  clientKeyFile,
-		"port":       port,
-		"timeout":    timeout,
-		"verbose":    verbose,
+		"version":            version,
+		"configFile":         configFile,
+		"ravenDbUrl":         ravenDbURL,
+		"caCert":             caCertFile,
+		"useAuth":            useAuth,
+		"clientCert":         clientCertFile,
+		"clientKey":          clientKeyFile,
+		"clientPfx":          clientPfxFile,
+		"tlsProfiles":        tlsProfilesFile,
+		"webConfig":          webConfigFile,
+		"port":               port,
+		"timeout":            timeout,
+		"collectionInterval": collectionInterval,
+		"discoverCluster":    discoverCluster,
+		"databaseInclude":    databaseIncludePatterns,
+		"databaseExclude":    databaseExcludePatterns,
+		"targets":            len(probeTargets),
+		"labelRewrites":      len(labelRewrites),
+		"collectors":         enabledCollectors(),
+		"verbose":            verbose,
 	}).Infof("RavenDB exporter configured")
 
-	if useAuth && (caCertFile == "" || clientCertFile == "" || clientKeyFile == "") {
-		log.Fatal("Invalid configuration: when using authentication you need to specify the CA cert, client cert and client private key")
+	if err := defaultTLSProfile().validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
 	}
+
+	filters, err := newDatabaseFilter(databaseIncludePatterns, databaseExcludePatterns)
+	if err != nil {
+		log.Fatal("Invalid configuration: invalid database filter: ", err)
+	}
+	databaseFilters = filters
 }
 
 func setupLogger() {
@@ -86,9 +156,42 @@ func setupLogger() {
 	}
 }
 
-func startHTTPServer() {
+func loadWebConfig() *webConfigReloader {
+	if webConfigFile == "" {
+		return nil
+	}
+
+	reloader := newWebConfigReloader(webConfigFile)
+	if err := reloader.reload(); err != nil {
+		log.WithError(err).Fatal("Invalid web config")
+	}
+	go watchWebConfig(reloader, tlsReloadInterval)
+
+	return reloader
+}
+
+func startHTTPServer(web *webConfigReloader) {
 	listenAddr := fmt.Sprintf(":%d", port)
-	log.Fatal(http.ListenAndServe(listenAddr, nil))
+	if web == nil {
+		log.Fatal(http.ListenAndServe(listenAddr, nil))
+	}
+
+	server := &http.Server{
+		Addr:    listenAddr,
+		Handler: web.basicAuth(http.DefaultServeMux),
+	}
+
+	// whether TLS is used is decided at startup, the TLS settings themselves are reloaded
+	config, _ := web.current()
+	if config.TLSServerConfig == nil {
+		log.Fatal(server.ListenAndServe())
+	}
+
+	server.TLSConfig = &tls.Config{
+		GetCertificate:     web.getCertificate,
+		GetConfigForClient: web.getConfigForClient,
+	}
+	log.Fatal(server.ListenAndServeTLS("", ""))
 }
 
 func main() {
@@ -96,10 +199,18 @@ func main() {
 	readAndValidateConfig()
 	setupLogger()
 
-	initializeClient()
+	initializeTransports()
+	web := loadWebConfig()
+	if checkConfig {
+		log.Info("Configuration is valid")
+		return
+	}
+
+	registerExporterMetrics()
 
 	serveLandingPage()
 	serveMetrics()
+	serveProbe()
 
-	startHTTPServer()
+	startHTTPServer(web)
 }
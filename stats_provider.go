@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type statsSnapshot struct {
+	stats       *stats
+	err         error
+	duration    time.Duration
+	collectedAt time.Time
+}
+
+// statsProvider gets stats from RavenDB for the exporter. With a zero interval stats are
+// collected on every scrape, otherwise they are collected in the background and scrapes are
+// served from the latest snapshot. Concurrent scrapes never start duplicate collections.
+type statsProvider struct {
+	client   *ravenDbClient
+	interval time.Duration
+
+	group singleflight.Group
+	done  chan struct{}
+
+	mutex  sync.RWMutex
+	latest *statsSnapshot
+}
+
+func newStatsProvider(client *ravenDbClient, interval time.Duration) *statsProvider {
+	return &statsProvider{
+		client:   client,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *statsProvider) start() {
+	if p.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.collect()
+
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+func (p *statsProvider) stop() {
+	close(p.done)
+}
+
+func (p *statsProvider) getSnapshot() *statsSnapshot {
+	if p.interval > 0 {
+		p.mutex.RLock()
+		latest := p.latest
+		p.mutex.RUnlock()
+
+		if latest != nil {
+			return latest
+		}
+	}
+
+	// synchronous mode, or the first background collection has not finished yet
+	return p.collect()
+}
+
+func (p *statsProvider) collect() *statsSnapshot {
+	snapshot, _, _ := p.group.Do("stats", func() (interface{}, error) {
+		log.WithField("target", p.client.url).Info("Collecting stats")
+
+		start := time.Now()
+		stats, err := p.client.getStats()
+		if err != nil {
+			log.WithError(err).WithField("target", p.client.url).Error("Error while getting data from RavenDB")
+		}
+
+		snapshot := &statsSnapshot{
+			stats:       stats,
+			err:         err,
+			duration:    time.Since(start),
+			collectedAt: time.Now(),
+		}
+
+		p.mutex.Lock()
+		p.latest = snapshot
+		p.mutex.Unlock()
+
+		return snapshot, nil
+	})
+
+	return snapshot.(*statsSnapshot)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentScrapesShareCollection(t *testing.T) {
+
+	var databaseListCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == databasesEndpoint {
+			atomic.AddInt32(&databaseListCalls, 1)
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte(`{"Databases": []}`)) // nolint: errcheck
+			return
+		}
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	provider := newStatsProvider(newRavenDbClient(server.URL, http.DefaultTransport), 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if snapshot := provider.getSnapshot(); snapshot.err != nil {
+				t.Error(snapshot.err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&databaseListCalls); calls != 1 {
+		t.Errorf("Expected concurrent scrapes to share 1 collection but RavenDB was called %d times", calls)
+	}
+}
+
+func TestBackgroundCollectionServesCachedSnapshot(t *testing.T) {
+
+	var databaseListCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == databasesEndpoint {
+			atomic.AddInt32(&databaseListCalls, 1)
+			w.Write([]byte(`{"Databases": []}`)) // nolint: errcheck
+			return
+		}
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	provider := newStatsProvider(newRavenDbClient(server.URL, http.DefaultTransport), time.Hour)
+	provider.start()
+	defer provider.stop()
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&databaseListCalls) == 1 })
+
+	first := provider.getSnapshot()
+	for i := 0; i < 5; i++ {
+		if snapshot := provider.getSnapshot(); snapshot != first {
+			t.Error("Expected scrapes to be served from the background snapshot")
+		}
+	}
+
+	if calls := atomic.LoadInt32(&databaseListCalls); calls != 1 {
+		t.Errorf("Expected only the background collection to call RavenDB but it was called %d times", calls)
+	}
+}
+
+func TestStopEndsBackgroundCollection(t *testing.T) {
+
+	var databaseListCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == databasesEndpoint {
+			atomic.AddInt32(&databaseListCalls, 1)
+		}
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	provider := newStatsProvider(newRavenDbClient(server.URL, http.DefaultTransport), 10*time.Millisecond)
+	provider.start()
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&databaseListCalls) >= 2 })
+	provider.stop()
+
+	// a collection may still be in progress when stop is called
+	time.Sleep(50 * time.Millisecond)
+	stopped := atomic.LoadInt32(&databaseListCalls)
+	time.Sleep(100 * time.Millisecond)
+
+	if calls := atomic.LoadInt32(&databaseListCalls); calls != stopped {
+		t.Errorf("Expected no collections after stop but RavenDB was called %d more times", calls-stopped)
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
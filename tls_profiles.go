@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultTLSProfileName = "default"
+
+var (
+	transports map[string]http.RoundTripper
+)
+
+type tlsProfile struct {
+	CACertFile        string `yaml:"ca_cert"`
+	UseAuth           bool   `yaml:"use_auth"`
+	ClientCertFile    string `yaml:"client_cert"`
+	ClientKeyFile     string `yaml:"client_key"`
+	ClientKeyPassword string `yaml:"client_key_password"`
+	ClientPfxFile     string `yaml:"client_pfx"`
+	ClientPfxPassword string `yaml:"client_pfx_password"`
+}
+
+func defaultTLSProfile() *tlsProfile {
+	return &tlsProfile{
+		CACertFile:        caCertFile,
+		UseAuth:           useAuth,
+		ClientCertFile:    clientCertFile,
+		ClientKeyFile:     clientKeyFile,
+		ClientKeyPassword: clientKeyPassword,
+		ClientPfxFile:     clientPfxFile,
+		ClientPfxPassword: clientPfxPassword,
+	}
+}
+
+func (p *tlsProfile) validate() error {
+	if !p.UseAuth {
+		return nil
+	}
+
+	usePEM := p.ClientCertFile != "" || p.ClientKeyFile != ""
+	usePfx := p.ClientPfxFile != ""
+
+	if usePEM && usePfx {
+		return errors.New("specify either the client cert and private key or the PKCS#12 bundle, not both")
+	}
+	if p.CACertFile == "" || !usePfx && (p.ClientCertFile == "" || p.ClientKeyFile == "") {
+		return errors.New("when using authentication you need to specify the CA cert, and either the client cert and client private key or the PKCS#12 bundle")
+	}
+	return nil
+}
+
+func initializeTransports() {
+	profiles, err := loadTLSProfiles()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid TLS profiles configuration")
+	}
+	if err := validateTargets(profiles); err != nil {
+		log.WithError(err).Fatal("Invalid targets configuration")
+	}
+
+	transports = make(map[string]http.RoundTripper)
+	var reloaders []*certificateReloader
+	for name, profile := range profiles {
+		reloader := newCertificateReloader(name, profile)
+		if err := reloader.reload(); err != nil {
+			log.WithError(err).WithField("profile", name).Fatal("Error while preparing TLS configuration")
+		}
+		reloaders = append(reloaders, reloader)
+
+		transports[name] = reloader
+	}
+
+	go watchCertificates(reloaders, tlsReloadInterval)
+}
+
+func loadTLSProfiles() (map[string]*tlsProfile, error) {
+	profiles := map[string]*tlsProfile{
+		defaultTLSProfileName: defaultTLSProfile(),
+	}
+
+	namedProfiles := map[string]*tlsProfile{}
+	for name, profile := range configTLSProfiles {
+		namedProfiles[name] = profile
+	}
+
+	if tlsProfilesFile != "" {
+		data, err := ioutil.ReadFile(tlsProfilesFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var fileProfiles map[string]*tlsProfile
+		if err := yaml.UnmarshalStrict(data, &fileProfiles); err != nil {
+			return nil, err
+		}
+
+		for name, profile := range fileProfiles {
+			if _, ok := namedProfiles[name]; ok {
+				return nil, fmt.Errorf("profile %q is defined both in the config file and the TLS profiles file", name)
+			}
+			namedProfiles[name] = profile
+		}
+	}
+
+	for name, profile := range namedProfiles {
+		if name == defaultTLSProfileName {
+			return nil, fmt.Errorf("profile name %q is reserved for the profile configured with flags", name)
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("profile %q is empty", name)
+		}
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", name, err)
+		}
+		profiles[name] = profile
+	}
+
+	return profiles, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// idleConnTimeout closes idle connections of replaced transports, which in-flight requests
+// return their connections to after the transport was swapped
+const idleConnTimeout = 90 * time.Second
+
+// certificateReloader is the transport of a TLS profile. It re-reads the CA and client
+// certificate when the underlying files change. The client certificate is presented through
+// GetClientCertificate, a changed CA needs a new transport, which is swapped in on every reload
+// so that new connections are made with the new certificates.
+type certificateReloader struct {
+	name    string
+	profile *tlsProfile
+
+	mutex       sync.RWMutex
+	transport   *http.Transport
+	certificate *tls.Certificate
+	fingerprint []byte
+}
+
+func newCertificateReloader(name string, profile *tlsProfile) *certificateReloader {
+	return &certificateReloader{
+		name:    name,
+		profile: profile,
+	}
+}
+
+// watchCertificates reloads changed certificates on the given interval and all certificates on SIGHUP
+func watchCertificates(reloaders []*certificateReloader, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			for _, reloader := range reloaders {
+				if err := reloader.reloadIfChanged(); err != nil {
+					log.WithError(err).WithField("profile", reloader.name).Error("Error while reloading certificates, keeping the previous ones")
+				}
+			}
+		case <-hup:
+			log.Info("Received SIGHUP, reloading certificates")
+			for _, reloader := range reloaders {
+				if err := reloader.reload(); err != nil {
+					log.WithError(err).WithField("profile", reloader.name).Error("Error while reloading certificates, keeping the previous ones")
+				}
+			}
+		}
+	}
+}
+
+func (r *certificateReloader) reloadIfChanged() error {
+	fingerprint, err := r.profile.filesFingerprint()
+	if err != nil {
+		tlsReloadSuccess.WithLabelValues(r.name).Set(0)
+		return err
+	}
+
+	r.mutex.RLock()
+	changed := !bytes.Equal(fingerprint, r.fingerprint)
+	r.mutex.RUnlock()
+
+	if !changed {
+		return nil
+	}
+	return r.reload()
+}
+
+func (r *certificateReloader) reload() error {
+	err := r.load()
+	if err != nil {
+		tlsReloadSuccess.WithLabelValues(r.name).Set(0)
+		return err
+	}
+
+	tlsReloadSuccess.WithLabelValues(r.name).Set(1)
+	tlsReloadSuccessTimestamp.WithLabelValues(r.name).Set(float64(now().Unix()))
+	return nil
+}
+
+func (r *certificateReloader) load() error {
+	fingerprint, err := r.profile.filesFingerprint()
+	if err != nil {
+		return err
+	}
+
+	var rootCAs *x509.CertPool
+	if r.profile.CACertFile != "" {
+		if rootCAs, err = loadCACertPool(r.profile.CACertFile); err != nil {
+			return err
+		}
+	}
+
+	var certificate *tls.Certificate
+	if r.profile.UseAuth {
+		cert, err := loadClientCertificate(r.profile)
+		if err != nil {
+			return err
+		}
+		if cert.Leaf == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return err
+			}
+		}
+		certificate = &cert
+
+		clientCertificateExpiry.WithLabelValues(r.name).Set(float64(cert.Leaf.NotAfter.Unix()))
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: prepareTLSConfig(r, rootCAs),
+		IdleConnTimeout: idleConnTimeout,
+	}
+
+	r.mutex.Lock()
+	previous := r.transport
+	r.transport = transport
+	r.certificate = certificate
+	r.fingerprint = fingerprint
+	r.mutex.Unlock()
+
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+
+	log.WithField("profile", r.name).Info("Loaded certificates")
+
+	return nil
+}
+
+func (r *certificateReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.certificate, nil
+}
+
+// RoundTrip sends the request using the transport built from the most recently loaded certificates
+func (r *certificateReloader) RoundTrip(request *http.Request) (*http.Response, error) {
+	r.mutex.RLock()
+	transport := r.transport
+	r.mutex.RUnlock()
+
+	return transport.RoundTrip(request)
+}
+
+func (p *tlsProfile) filesFingerprint() ([]byte, error) {
+	hash := sha256.New()
+	for _, file := range []string{p.CACertFile, p.ClientCertFile, p.ClientKeyFile, p.ClientPfxFile} {
+		if file == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(data) // nolint: errcheck
+	}
+	return hash.Sum(nil), nil
+}
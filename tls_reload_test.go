@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertificateReloaderPicksUpRotatedCertificate(t *testing.T) {
+
+	// the server responds with the common name of the client certificate it was presented
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName)) // nolint: errcheck
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	profile := &tlsProfile{
+		CACertFile:     filepath.Join(dir, "ca.crt"),
+		UseAuth:        true,
+		ClientCertFile: filepath.Join(dir, "client.crt"),
+		ClientKeyFile:  filepath.Join(dir, "client.key"),
+	}
+	writePEM(t, profile.CACertFile, "CERTIFICATE", server.Certificate().Raw)
+
+	writeTestKeyPair(t, profile.ClientCertFile, profile.ClientKeyFile, "First client")
+
+	reloader := newCertificateReloader("test", profile)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	assertClientCertificate(t, reloader, server.URL, "First client")
+
+	if err := reloader.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	assertClientCertificate(t, reloader, server.URL, "First client")
+
+	writeTestKeyPair(t, profile.ClientCertFile, profile.ClientKeyFile, "Second client")
+
+	if err := reloader.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	assertClientCertificate(t, reloader, server.URL, "Second client")
+
+	if err := os.WriteFile(profile.ClientKeyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reloadIfChanged(); err == nil {
+		t.Error("Expected error when reloading an invalid private key")
+	}
+	assertClientCertificate(t, reloader, server.URL, "Second client")
+}
+
+func TestCertificateReloaderVerifiesServerWithLoadedCA(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	profile := &tlsProfile{CACertFile: filepath.Join(dir, "ca.crt")}
+	writePEM(t, profile.CACertFile, "CERTIFICATE", server.Certificate().Raw)
+
+	reloader := newCertificateReloader("test", profile)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: reloader}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected server certificate to be trusted, but got %v", err)
+	}
+	response.Body.Close()
+
+	_, otherCA := createTestCertificate(t, "Other CA", nil, nil)
+	writePEM(t, profile.CACertFile, "CERTIFICATE", otherCA.Raw)
+	if err := reloader.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("Expected server certificate to be rejected after CA rotation")
+	}
+}
+
+func TestCertificateReloaderVerifiesServerHostname(t *testing.T) {
+
+	caKey, ca := createTestCertificate(t, "Test CA", nil, nil)
+
+	dir := t.TempDir()
+	profile := &tlsProfile{CACertFile: filepath.Join(dir, "ca.crt")}
+	writePEM(t, profile.CACertFile, "CERTIFICATE", ca.Raw)
+
+	reloader := newCertificateReloader("test", profile)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: reloader}
+
+	tests := []struct {
+		name        string
+		dnsNames    []string
+		ipAddresses []net.IP
+		trusted     bool
+	}{
+		{"IP SAN of the target", nil, []net.IP{net.ParseIP("127.0.0.1")}, true},
+		{"other IP SAN", nil, []net.IP{net.ParseIP("10.0.0.1")}, false},
+		{"DNS SAN only", []string{"evil.example"}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, cert := createTestCertificate(t, "Server", ca, caKey, func(template *x509.Certificate) {
+				template.DNSNames = test.dnsNames
+				template.IPAddresses = test.ipAddresses
+			})
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}}
+			server.StartTLS()
+			defer server.Close()
+
+			response, err := client.Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			if test.trusted && err != nil {
+				t.Errorf("Expected server certificate to be trusted, but got %v", err)
+			}
+			if !test.trusted && err == nil {
+				t.Error("Expected server certificate to be rejected for 127.0.0.1")
+			}
+		})
+	}
+}
+
+func writeTestKeyPair(t *testing.T, certFile string, keyFile string, commonName string) {
+	key, cert := createTestCertificate(t, commonName, nil, nil)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM(t, certFile, "CERTIFICATE", cert.Raw)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+}
+
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertClientCertificate checks the client certificate the server was presented in the TLS handshake
+func assertClientCertificate(t *testing.T, reloader *certificateReloader, url string, commonName string) {
+	t.Helper()
+
+	response, err := (&http.Client{Transport: reloader}).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	presented, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(presented) != commonName {
+		t.Errorf("Expected client certificate of %s but got %s", commonName, presented)
+	}
+}
@@ -10,46 +10,77 @@ import (
 	"errors"
 	"io/ioutil"
 	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
 )
 
-func prepareTLSConfig() *tls.Config {
-	tlsConfig := &tls.Config{}
+// prepareTLSConfig builds TLS configuration trusting the given CA pool, a nil pool falls back to
+// the system roots. The client certificate currently loaded by the reloader is presented, so a
+// rotated certificate is picked up without a restart
+func prepareTLSConfig(reloader *certificateReloader, rootCAs *x509.CertPool) *tls.Config {
+	tlsConfig := &tls.Config{RootCAs: rootCAs}
 
-	if caCertFile != "" {
-		caCertData, err := ioutil.ReadFile(caCertFile)
-		if err != nil {
-			log.Fatal(err)
-		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCertData)
-		tlsConfig.RootCAs = caCertPool
+	if reloader.profile.UseAuth {
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
 	}
 
-	if useAuth {
+	return tlsConfig
+}
 
-		cert, err := loadX509KeyPair(clientCertFile, clientKeyFile, clientKeyPassword)
-		if err != nil {
-			log.Fatal(err)
-		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
-		tlsConfig.BuildNameToCertificate()
+func loadCACertPool(caCertFile string) (*x509.CertPool, error) {
+	caCertData, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
 	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCertData) {
+		return nil, errors.New("Failed to parse any certificate from CA cert file")
+	}
+	return caCertPool, nil
+}
 
-	return tlsConfig
+func loadClientCertificate(profile *tlsProfile) (tls.Certificate, error) {
+	if profile.ClientPfxFile != "" {
+		return loadPKCS12(profile.ClientPfxFile, profile.ClientPfxPassword)
+	}
+	return loadX509KeyPair(profile.ClientCertFile, profile.ClientKeyFile, profile.ClientKeyPassword)
+}
+
+// loadPKCS12 loads a client certificate from a .pfx bundle, like the ones exported by RavenDB,
+// including any intermediate certificates in the bundle
+func loadPKCS12(pfxFile, password string) (cert tls.Certificate, err error) {
+	pfxData, err := ioutil.ReadFile(pfxFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	privateKey, leaf, caCerts, err := pkcs12.DecodeChain(pfxData, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert.PrivateKey = privateKey
+	cert.Leaf = leaf
+	cert.Certificate = append(cert.Certificate, leaf.Raw)
+	for _, caCert := range caCerts {
+		cert.Certificate = append(cert.Certificate, caCert.Raw)
+	}
+
+	return cert, nil
 }
 
 func loadX509KeyPair(certFile, keyFile, password string) (cert tls.Certificate, err error) {
-	clientCertData, err := ioutil.ReadFile(clientCertFile)
+	clientCertData, err := ioutil.ReadFile(certFile)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
 
-	clientKeyData, err := ioutil.ReadFile(clientKeyFile)
+	clientKeyData, err := ioutil.ReadFile(keyFile)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
 
-	return createX509KeyPair(clientCertData, clientKeyData, clientKeyPassword)
+	return createX509KeyPair(clientCertData, clientKeyData, password)
 }
 
 // code below is partially extracted from Golang standard library Copyright (c) 2009 The Go Authors
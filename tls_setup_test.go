@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestLoadPKCS12WithChain(t *testing.T) {
+
+	caKey, caCert := createTestCertificate(t, "Test CA", nil, nil)
+	clientKey, clientCert := createTestCertificate(t, "Test client", caCert, caKey)
+
+	pfxData, err := pkcs12.Modern.Encode(clientKey, clientCert, []*x509.Certificate{caCert}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pfxFile := filepath.Join(t.TempDir(), "client.pfx")
+	if err := os.WriteFile(pfxFile, pfxData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := loadPKCS12(pfxFile, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("Expected client certificate and its chain but got %d certificates", len(cert.Certificate))
+	}
+	if cert.Leaf.Subject.CommonName != "Test client" {
+		t.Errorf("Expected leaf certificate of Test client but got %s", cert.Leaf.Subject.CommonName)
+	}
+	if _, ok := cert.PrivateKey.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("Expected ECDSA private key but got %T", cert.PrivateKey)
+	}
+
+	if _, err := loadPKCS12(pfxFile, "wrong"); err == nil {
+		t.Error("Expected error when loading PKCS#12 bundle with wrong password")
+	}
+}
+
+func createTestCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, customize ...func(*x509.Certificate)) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+
+	for _, c := range customize {
+		c(template)
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, cert
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+var webConfigFile string
+
+// webConfig is the format of the file given with --web-config-file, compatible with
+// the web configuration of Prometheus exporter-toolkit
+type webConfig struct {
+	TLSServerConfig *tlsServerConfig  `yaml:"tls_server_config"`
+	BasicAuthUsers  map[string]string `yaml:"basic_auth_users"`
+}
+
+type tlsServerConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+	MinVersion     string `yaml:"min_version"`
+}
+
+// dummyPasswordHash is compared against for unknown users
+const dummyPasswordHash = "$2a$10$UT1VfMbazSn9IQIB8bOZdu/zcq/K6e0a7R68sE9z/gw9P/Uw7Jkgy"
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// webConfigReloader holds the web config file and the TLS configuration built from the
+// certificates it refers to. The files are checked for changes on an interval and re-read
+// on SIGHUP, so changes are applied without a restart. If the new config is invalid, the
+// previous one stays in use.
+type webConfigReloader struct {
+	path string
+
+	mutex       sync.RWMutex
+	config      *webConfig
+	tlsConfig   *tls.Config
+	fingerprint []byte
+
+	authCache sync.Map
+}
+
+func newWebConfigReloader(path string) *webConfigReloader {
+	return &webConfigReloader{path: path}
+}
+
+// watchWebConfig reloads the changed web config on the given interval and unconditionally on SIGHUP
+func watchWebConfig(reloader *webConfigReloader, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-tick:
+			err = reloader.reloadIfChanged()
+		case <-hup:
+			err = reloader.reload()
+		}
+		if err != nil {
+			log.WithError(err).WithField("file", reloader.path).Error("Error while reloading web config, keeping the previous one")
+		}
+	}
+}
+
+func (r *webConfigReloader) current() (*webConfig, *tls.Config) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.config, r.tlsConfig
+}
+
+func (r *webConfigReloader) reloadIfChanged() error {
+	config, fingerprint, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.RLock()
+	changed := !bytes.Equal(fingerprint, r.fingerprint)
+	r.mutex.RUnlock()
+
+	if !changed {
+		return nil
+	}
+	return r.apply(config, fingerprint)
+}
+
+func (r *webConfigReloader) reload() error {
+	config, fingerprint, err := r.read()
+	if err != nil {
+		return err
+	}
+	return r.apply(config, fingerprint)
+}
+
+func (r *webConfigReloader) read() (*webConfig, []byte, error) {
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &webConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, nil, err
+	}
+
+	fingerprint, err := config.fingerprint(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, fingerprint, nil
+}
+
+func (r *webConfigReloader) apply(config *webConfig, fingerprint []byte) error {
+	if err := config.validateUsers(); err != nil {
+		return err
+	}
+	tlsConfig, err := config.prepareTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.config = config
+	r.tlsConfig = tlsConfig
+	r.fingerprint = fingerprint
+	r.mutex.Unlock()
+
+	log.WithField("file", r.path).Info("Loaded web config")
+
+	return nil
+}
+
+func (c *webConfig) fingerprint(data []byte) ([]byte, error) {
+	hash := sha256.New()
+	hash.Write(data) // nolint: errcheck
+
+	if c.TLSServerConfig != nil {
+		for _, file := range []string{c.TLSServerConfig.CertFile, c.TLSServerConfig.KeyFile, c.TLSServerConfig.ClientCAFile} {
+			if file == "" {
+				continue
+			}
+			fileData, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			hash.Write(fileData) // nolint: errcheck
+		}
+	}
+	return hash.Sum(nil), nil
+}
+
+func (c *webConfig) validateUsers() error {
+	for user, hashed := range c.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hashed)); err != nil {
+			return fmt.Errorf("password of user %q is not a valid bcrypt hash: %v", user, err)
+		}
+	}
+	return nil
+}
+
+func (c *webConfig) prepareTLSConfig() (*tls.Config, error) {
+	tlsServer := c.TLSServerConfig
+	if tlsServer == nil {
+		return nil, nil
+	}
+
+	if tlsServer.CertFile == "" || tlsServer.KeyFile == "" {
+		return nil, errors.New("tls_server_config needs both cert_file and key_file")
+	}
+	cert, err := tls.LoadX509KeyPair(tlsServer.CertFile, tlsServer.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tlsServer.MinVersion != "" {
+		version, ok := tlsVersions[tlsServer.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version %q", tlsServer.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if tlsServer.ClientCAFile != "" {
+		if config.ClientCAs, err = loadCACertPool(tlsServer.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// like in exporter-toolkit, client certificates are not requested unless client_auth_type is set
+
+	if tlsServer.ClientAuthType != "" {
+		clientAuth, ok := clientAuthTypes[tlsServer.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("unknown client_auth_type %q", tlsServer.ClientAuthType)
+		}
+		if clientAuth >= tls.VerifyClientCertIfGiven && config.ClientCAs == nil {
+			return nil, fmt.Errorf("client_auth_type %s needs client_ca_file", tlsServer.ClientAuthType)
+		}
+		config.ClientAuth = clientAuth
+	}
+
+	return config, nil
+}
+
+func (r *webConfigReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	_, tlsConfig := r.current()
+	if tlsConfig == nil {
+		return nil, errors.New("TLS was disabled in the web config, restart the exporter to serve plain HTTP")
+	}
+	return tlsConfig, nil
+}
+
+func (r *webConfigReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	_, tlsConfig := r.current()
+	if tlsConfig == nil {
+		return nil, errors.New("TLS was disabled in the web config, restart the exporter to serve plain HTTP")
+	}
+	return &tlsConfig.Certificates[0], nil
+}
+
+// basicAuth wraps the handler with basic authentication if the web config has any users
+func (r *webConfigReloader) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		config, _ := r.current()
+		if len(config.BasicAuthUsers) > 0 {
+			user, password, ok := req.BasicAuth()
+			if !ok || !r.authenticate(config, user, password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="ravendb_exporter"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// authenticate checks the password against the bcrypt hash. Successful checks are cached,
+// since bcrypt is deliberately slow and Prometheus sends the same credentials on every scrape.
+func (r *webConfigReloader) authenticate(config *webConfig, user, password string) bool {
+	hashed, ok := config.BasicAuthUsers[user]
+	if !ok {
+		// compare anyway, so unknown users take as long as wrong passwords
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password)) // nolint: errcheck
+		return false
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hashed))
+	if _, ok := r.authCache.Load(key); ok {
+		return true
+	}
+
+	authenticated := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+	if authenticated {
+		r.authCache.Store(key, struct{}{})
+	}
+	return authenticated
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bcrypt hash of "secret" with cost 4
+const testPasswordHash = "$2a$04$GgV6PB2HQE557Z5Q/wG5cuuiZ2pWn/CbgeFA/MU.FJ5Flel6k9kVO"
+
+func TestWebConfigBasicAuth(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "web.yml")
+	writeWebConfig(t, file, fmt.Sprintf("basic_auth_users:\n  alice: %s\n", testPasswordHash))
+
+	reloader := newWebConfigReloader(file)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(reloader.basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer server.Close()
+
+	assertStatusCode(t, server.URL, "alice", "secret", http.StatusOK)
+	assertStatusCode(t, server.URL, "alice", "wrong", http.StatusUnauthorized)
+	assertStatusCode(t, server.URL, "bob", "secret", http.StatusUnauthorized)
+	assertStatusCode(t, server.URL, "", "", http.StatusUnauthorized)
+
+	writeWebConfig(t, file, fmt.Sprintf("basic_auth_users:\n  bob: %s\n", testPasswordHash))
+
+	// the file is only read again when the watcher checks it
+	assertStatusCode(t, server.URL, "alice", "secret", http.StatusOK)
+
+	if err := reloader.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	assertStatusCode(t, server.URL, "alice", "secret", http.StatusUnauthorized)
+	assertStatusCode(t, server.URL, "bob", "secret", http.StatusOK)
+
+	writeWebConfig(t, file, "basic_auth_users:\n  bob: not-a-hash\n")
+
+	if err := reloader.reloadIfChanged(); err == nil {
+		t.Error("Expected error when reloading an invalid password hash")
+	}
+	assertStatusCode(t, server.URL, "bob", "secret", http.StatusOK)
+}
+
+func TestWebConfigReloadsServerCertificate(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	file := filepath.Join(dir, "web.yml")
+	writeWebConfig(t, file, fmt.Sprintf("tls_server_config:\n  cert_file: %s\n  key_file: %s\n  min_version: TLS13\n", certFile, keyFile))
+	writeTestKeyPair(t, certFile, keyFile, "First server")
+
+	reloader := newWebConfigReloader(file)
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	assertServerCertificate(t, reloader, "First server")
+
+	writeTestKeyPair(t, certFile, keyFile, "Second server")
+	assertServerCertificate(t, reloader, "First server")
+
+	if err := reloader.reloadIfChanged(); err != nil {
+		t.Fatal(err)
+	}
+	assertServerCertificate(t, reloader, "Second server")
+
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reloadIfChanged(); err == nil {
+		t.Error("Expected error when reloading an invalid private key")
+	}
+	assertServerCertificate(t, reloader, "Second server")
+}
+
+func TestWebConfigClientAuthType(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeTestKeyPair(t, certFile, keyFile, "Server")
+
+	testCases := []struct {
+		clientAuthType string
+		expected       tls.ClientAuthType
+	}{
+		{"", tls.NoClientCert},
+		{"RequireAndVerifyClientCert", tls.RequireAndVerifyClientCert},
+	}
+
+	for _, testCase := range testCases {
+		t.Run("client_auth_type "+testCase.clientAuthType, func(t *testing.T) {
+			config := &webConfig{TLSServerConfig: &tlsServerConfig{
+				CertFile:       certFile,
+				KeyFile:        keyFile,
+				ClientCAFile:   certFile,
+				ClientAuthType: testCase.clientAuthType,
+			}}
+
+			tlsConfig, err := config.prepareTLSConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tlsConfig.ClientAuth != testCase.expected {
+				t.Errorf("Expected client auth %v but got %v", testCase.expected, tlsConfig.ClientAuth)
+			}
+		})
+	}
+}
+
+func writeWebConfig(t *testing.T, file string, content string) {
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertStatusCode(t *testing.T, url string, user string, password string, expected int) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		request.SetBasicAuth(user, password)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != expected {
+		t.Errorf("Expected status %d for user %q but got %d", expected, user, response.StatusCode)
+	}
+}
+
+func assertServerCertificate(t *testing.T, reloader *webConfigReloader, commonName string) {
+	config, err := reloader.getConfigForClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Certificates[0].Leaf == nil {
+		t.Fatal("Expected a parsed server certificate")
+	}
+	if actual := config.Certificates[0].Leaf.Subject.CommonName; actual != commonName {
+		t.Errorf("Expected server certificate %q but got %q", commonName, actual)
+	}
+}